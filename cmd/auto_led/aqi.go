@@ -9,17 +9,15 @@ import (
 	"time"
 
 	"github.com/Jeffail/gabs"
+
+	"github.com/starryalley/smart_home/pkg/config"
 )
 
 var httpClient = &http.Client{Timeout: 10 * time.Second}
 
-const geoLocation = "-37;145"
-
-//get your token here: https://aqicn.org/data-platform/token/#/
-const token = "YOUR_TOKEN_HERE"
-
-func getAQI() (float64, error) {
-	r, err := httpClient.Get(fmt.Sprintf("https://api.waqi.info/feed/geo:%s/?token=%s", geoLocation, token))
+func getAQI(location config.Location, token string) (float64, error) {
+	r, err := httpClient.Get(fmt.Sprintf("https://api.waqi.info/feed/geo:%v;%v/?token=%s",
+		location.Latitude, location.Longitude, token))
 	if err != nil {
 		return 0.0, err
 	}
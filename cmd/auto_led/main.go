@@ -1,69 +1,194 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
 
-	"github.com/gofrs/flock"
-
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/drivers/gpio"
 	"gobot.io/x/gobot/platforms/raspi"
 
+	"github.com/starryalley/smart_home/pkg/broker"
 	"github.com/starryalley/smart_home/pkg/colors"
+	"github.com/starryalley/smart_home/pkg/comfort"
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/leds"
 	"github.com/starryalley/smart_home/pkg/logs"
 	"github.com/starryalley/smart_home/pkg/sensors"
 )
 
-const (
-	updateInterval = 60   // update interval in seconds
-	pinR           = "11" // Pin names for LED R pins
-	pinG           = "13" // Pin names for LED G pins
-	pinB           = "15" // Pin names for LED B pins
-)
+var simulate = flag.Bool("sim", false, "use simulated sensor and LED instead of Raspberry Pi hardware")
+var configFlags = config.RegisterSensorFlags(flag.CommandLine)
+
+var colorByFlag = flag.String("color-by", "",
+	"colour the LED by temperature, humidity, dew_point, heat_index, absolute_humidity or comfort (overrides config)")
+
+// current config, reloaded when the file changes
+var conf *config.Watcher
+
+// value for color_by to colour the LED by comfort zone
+const colorByComfort = "comfort"
+
+// range of each quantity mapped from purple (low) to red (high), temperature
+// uses colors.TemperatureToColor
+var colorRanges = map[sensors.Quantity][2]float64{
+	sensors.Humidity:         {20, 90},
+	sensors.DewPoint:         {-5, 25},
+	sensors.HeatIndex:        {8, 40},
+	sensors.AbsoluteHumidity: {2, 20},
+}
+
+// LED colour of each comfort zone
+var zoneColors = map[comfort.Zone]colors.Color{
+	comfort.Comfortable: {R: 0, G: 255, B: 0},
+	comfort.Cold:        {R: 0, G: 0, B: 255},
+	comfort.Hot:         {R: 255, G: 0, B: 0},
+	comfort.Dry:         {R: 255, G: 255, B: 0},
+	comfort.Humid:       {R: 0, G: 255, B: 255},
+}
 
 var (
-	lastTemp      float32
+	lastValue     string
 	lastTempColor colors.Color
 	lastAqiColor  colors.Color
 )
 
-func updateAQI() {
-	aqi, err := getAQI()
+func updateAQI(cfg *config.Config) {
+	if cfg.AutoLED.WAQIToken == "" {
+		return
+	}
+	aqi, err := getAQI(cfg.Location, cfg.AutoLED.WAQIToken)
 	if err != nil {
 		log.Println("get AQI error:", err)
 		return
 	}
 	lastAqiColor = colors.AQIToColor(aqi)
+	events.Publish(events.New("waqi", events.Reading, "", strconv.FormatFloat(aqi, 'f', -1, 64)).With("quantity", "aqi"))
 }
 
-func updateTemperature(fileLockTemp *flock.Flock) {
-	temp, _, err := sensors.GetTempHum(fileLockTemp)
+// hex formats c as e.g. #ff8000
+func hex(c colors.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func updateTemperature(sensor sensors.Sensor) {
+	ctx, cancel := context.WithTimeout(context.Background(), sensors.DefaultReadTimeout)
+	defer cancel()
+	readings, err := sensor.Read(ctx)
 	if err != nil {
 		log.Printf("read temperature failed:%v\n", err)
 		return
 	}
-	// temperature changes
-	if lastTemp != temp {
-		lastTempColor = colors.TemperatureToColor(temp)
-		lastTemp = temp
-		log.Printf("Temperature:%.01f°C\n", lastTemp)
+	readings = append(readings, comfort.Derive(readings)...)
+	readings.Publish()
+
+	colorBy := conf.Config().AutoLED.ColorBy
+	var color colors.Color
+	var value string
+	if colorBy == colorByComfort {
+		zone, err := comfort.ZoneOf(readings)
+		if err != nil {
+			log.Printf("read temperature failed:%v\n", err)
+			return
+		}
+		color, value = zoneColors[zone], string(zone)
+	} else {
+		q := sensors.Quantity(colorBy)
+		v, err := readings.Value(q)
+		if err != nil {
+			log.Printf("read temperature failed:%v\n", err)
+			return
+		}
+		if q == sensors.Temperature {
+			color = colors.TemperatureToColor(float32(v))
+		} else {
+			color = colors.RangeToColor(v, colorRanges[q][0], colorRanges[q][1])
+		}
+		value = fmt.Sprintf("%.01f%s", v, q.Unit())
+	}
+	// value changes
+	if lastValue != value {
+		if color != lastTempColor {
+			events.Publish(events.New("led", events.Color, hex(lastTempColor), hex(color)).With("color_by", colorBy))
+		}
+		lastTempColor = color
+		lastValue = value
+		log.Printf("%s:%s\n", colorBy, value)
 	}
 }
 
 func main() {
-	logs.SetupSyslog("AutoLED")
+	flag.Parse()
+	var err error
+	conf, err = configFlags.Watch(func(c *config.Config) error {
+		if err := c.AutoLED.Validate(); err != nil {
+			return err
+		}
+		if *colorByFlag != "" {
+			c.AutoLED.ColorBy = *colorByFlag
+		}
+		colorBy := c.AutoLED.ColorBy
+		if _, ok := colorRanges[sensors.Quantity(colorBy)]; !ok &&
+			colorBy != string(sensors.Temperature) && colorBy != colorByComfort {
+			return fmt.Errorf("unknown color_by:%s", colorBy)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := conf.Config()
+	if cfg.AutoLED.WAQIToken == "" {
+		log.Printf("no WAQI token, AQI disabled (set auto_led.waqi_token or %s)\n", config.EnvWAQIToken)
+	}
 
-	// possible multi-process access
-	fileLockTemp := flock.New("/var/lock/dht22.lock")
+	hw := cfg.Hardware
+	spec, err := hw.TemperatureSensor()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	r := raspi.NewAdaptor()
-	led := gpio.NewRgbLedDriver(r, pinR, pinG, pinB)
+	var (
+		connections []gobot.Connection
+		devices     []gobot.Device
+		tempSensor  sensors.Sensor
+		led         leds.RGB
+		r           *raspi.Adaptor
+	)
+	if *simulate {
+		led = &leds.Simulated{}
+	} else {
+		logs.SetupSyslog("AutoLED")
+		r = raspi.NewAdaptor()
+		ledDriver := gpio.NewRgbLedDriver(r, hw.LED.Red, hw.LED.Green, hw.LED.Blue)
+		led = ledDriver
+		connections = append(connections, r)
+		devices = append(devices, ledDriver)
+	}
+	// the broker owns (and calibrates and filters) the sensor when it's running,
+	// and relays the events between the commands
+	if cfg.BrokerSocket != "" {
+		broker.RelayEvents(cfg.BrokerSocket, "auto_led")
+		tempSensor = cfg.BrokerClient(spec)
+	} else {
+		var device gobot.Device
+		if tempSensor, device, err = sensors.Setup(spec, r, *simulate, cfg.Calibration, cfg.Filters); err != nil {
+			log.Fatal(err)
+		}
+		if device != nil {
+			devices = append(devices, device)
+		}
+	}
 
 	work := func() {
-		// update temperature and LED every 1 min
-		gobot.Every(updateInterval*time.Second, func() {
-			updateTemperature(fileLockTemp)
+		// update temperature and LED
+		gobot.Every(cfg.AutoLED.UpdateInterval, func() {
+			updateTemperature(tempSensor)
 			go func() {
 				// alternating between AQI and temperature color for some time
 				//log.Printf("Set AQI RGB LED:%v,%v,%v\n", lastAqiColor.R, lastAqiColor.G, lastAqiColor.B)
@@ -80,20 +205,20 @@ func main() {
 				led.SetRGB(lastTempColor.R, lastTempColor.G, lastTempColor.B)
 			}()
 		})
-		// update AQI every 1 hour
-		gobot.Every(time.Hour, func() {
-			updateAQI()
+		// update AQI
+		gobot.Every(cfg.AutoLED.AQIInterval, func() {
+			updateAQI(conf.Config())
 		})
 	}
 
 	robot := gobot.NewRobot("temperatureBot",
-		[]gobot.Connection{r},
-		[]gobot.Device{led},
+		connections,
+		devices,
 		work,
 	)
 
 	// get initial AQI
-	updateAQI()
+	updateAQI(cfg)
 
 	robot.Start()
 }
@@ -1,64 +1,234 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/gofrs/flock"
 	"github.com/kelvins/sunrisesunset"
 
 	"gobot.io/x/gobot"
-	"gobot.io/x/gobot/drivers/i2c"
 	"gobot.io/x/gobot/platforms/raspi"
 
-	"github.com/starryalley/smart_home/pkg/cmds"
+	"github.com/starryalley/smart_home/pkg/broker"
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
 	"github.com/starryalley/smart_home/pkg/logs"
+	"github.com/starryalley/smart_home/pkg/notify"
+	"github.com/starryalley/smart_home/pkg/sensors"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
 )
 
-// Ringwood, VIC, Australia
-const latitude = -37.8114
-const longitude = 145.2306
+var simulate = flag.Bool("sim", false, "use simulated light sensor and gateway instead of real hardware")
+var configFlags = config.RegisterSensorFlags(flag.CommandLine)
 
-// calculated sunrise and sunset
-var sunriseTime time.Time
-var sunsetTime time.Time
+// current config, reloaded when the file changes
+var conf *config.Watcher
+
+// gateway client to control the plug
+var gateway xiaomi.Client
+
+// calculated sunrise and sunset, written under sunMu as isBright is also
+// called by followDoors
+var (
+	sunMu       sync.Mutex
+	sunriseTime time.Time
+	sunsetTime  time.Time
+)
 
 // coming midnight
 var midnight time.Time
 
-var lightOn = false
+// whether the lamp is on, and switchFailed and doorLightUntil below,
+// guarded by lightMu as they're used by the check loop, turnOffLight
+// goroutines, followPlug and followDoors
+var (
+	lightMu sync.Mutex
+	lightOn = false
+)
+
+// when the lamp switched on by a door opening at night goes off again, zero
+// if it wasn't
+var doorLightUntil time.Time
+
+// notification event when the lamp can't be switched, sent once until it
+// works again
+const eventLightFailed = "light_failed"
+
+var switchFailed = false
+
+// sends alerts, rate limited and held back in quiet hours
+var notifier *notify.Router
+
+// alert sends m to the notifiers of its event
+func alert(m notify.Message) {
+	notifier.Update(conf.Config().Notifications())
+	if err := notifier.Send(m); err != nil {
+		log.Printf("Notification failed:%v\n", err)
+	}
+}
+
+// switchLight turns the lamp on or off, alerting if the plug doesn't
+// respond. lightMu must be held.
+func switchLight(on bool) bool {
+	if err := gateway.Set(plug().ID, "power", strconv.FormatBool(on)); err != nil {
+		log.Printf("Switching light failed:%v\n", err)
+		if !switchFailed {
+			switchFailed = true
+			state := "off"
+			if on {
+				state = "on"
+			}
+			alert(notify.Message{
+				Event: eventLightFailed,
+				Title: "Auto Light",
+				Body:  fmt.Sprintf("Can't switch %s %s:%v", plug().Name, state, err),
+			})
+		}
+		return false
+	}
+	switchFailed = false
+	return true
+}
+
+// plug returns the smart plug of the lamp, checked when the config is loaded
+func plug() xiaomi.Device {
+	cfg := conf.Config()
+	d, _ := cfg.Device(cfg.AutoLight.Plug, xiaomi.CapPower)
+	return d
+}
 
 func checkLight() (bool, error) {
-	outs, err := cmds.RunCmdWithResult("/usr/local/lib/nodejs/bin/node /usr/local/lib/nodejs/bin/miio control 158d0002498b8e power")
+	on, err := xiaomi.GetBool(gateway, plug().ID, "power")
 	if err != nil {
 		return false, err
 	}
-	log.Printf("Light On:%s", outs[1])
-	return string(outs[1]) == "true", nil
+	log.Printf("Light On:%v", on)
+	return on, nil
 }
 
-func turnOnLight() {
-	if !lightOn {
-		log.Println("Turning on light")
-		cmds.RunCmd("/usr/local/lib/nodejs/bin/node /usr/local/lib/nodejs/bin/miio control 158d0002498b8e power true")
-		lightOn = true
+// setLight switches the lamp if it isn't already. lightMu must be held.
+func setLight(on bool) {
+	if on == lightOn {
+		return
+	}
+	old, state := events.On, events.Off
+	if on {
+		old, state = events.Off, events.On
+	}
+	log.Printf("Turning %s light\n", state)
+	if switchLight(on) {
+		lightOn = on
+		events.Publish(events.New(plug().ID, events.Power, old, state).With("by", "auto_light"))
 	}
 }
 
+func turnOnLight() {
+	lightMu.Lock()
+	defer lightMu.Unlock()
+	// it's dark, the lamp stays on whatever a door did
+	doorLightUntil = time.Time{}
+	setLight(true)
+}
+
 func turnOffLight() {
-	if lightOn {
-		log.Println("Turning off light")
-		cmds.RunCmd("/usr/local/lib/nodejs/bin/node /usr/local/lib/nodejs/bin/miio control 158d0002498b8e power false")
-		lightOn = false
+	lightMu.Lock()
+	defer lightMu.Unlock()
+	doorLightUntil = time.Time{}
+	setLight(false)
+}
+
+// followDoors turns the lamp on for auto_light.door_light when a door opens
+// at night, e.g. coming home after midnight. The door openings come from
+// door_monitor through the event relay.
+func followDoors() {
+	sub := events.Subscribe("auto_light doors", 0, string(events.Contact))
+	for e := range sub.Events() {
+		// only confirmed changes, not every gateway report
+		if e.Old != events.Closed || e.New != events.Open {
+			continue
+		}
+		d := conf.Config().AutoLight.DoorLight
+		if d <= 0 || isBright() {
+			continue
+		}
+		lightMu.Lock()
+		// on anyway, leave it to the check loop
+		if lightOn && doorLightUntil.IsZero() {
+			lightMu.Unlock()
+			continue
+		}
+		door := e.Meta["door"]
+		if door == "" {
+			door = e.Source
+		}
+		log.Printf("%s opened at night, light on for %v\n", door, d)
+		setLight(true)
+		if lightOn {
+			doorLightUntil = time.Now().Add(d)
+			time.AfterFunc(d, doorLightOff)
+		}
+		lightMu.Unlock()
 	}
 }
 
+// doorLightOff turns the lamp off once the last door opening keeping it on
+// is over
+func doorLightOff() {
+	lightMu.Lock()
+	defer lightMu.Unlock()
+	if doorLightUntil.IsZero() || time.Now().Before(doorLightUntil) {
+		return
+	}
+	doorLightUntil = time.Time{}
+	setLight(false)
+}
+
+// followPlug keeps lightOn up to date when the lamp is switched by hand or
+// from the app, from plug reports the gateway listener publishes
+func followPlug() {
+	sub := events.Subscribe("auto_light plug", 0, string(events.Power))
+	for e := range sub.Events() {
+		if e.Source != plug().ID {
+			continue
+		}
+		lightMu.Lock()
+		if on := e.New == events.On; on != lightOn {
+			log.Printf("Light On:%v (switched outside auto_light)\n", on)
+			lightOn = on
+		}
+		lightMu.Unlock()
+	}
+}
+
+// day or night at the last check, to publish sunrise and sunset
+var sunState string
+
+// publishSun publishes sunrise and sunset as they pass
+func publishSun(bright bool) {
+	state := events.Night
+	if bright {
+		state = events.Day
+	}
+	if state == sunState {
+		return
+	}
+	events.Publish(events.New("sun", events.Sun, sunState, state).
+		With("sunrise", sunriseTime.Format("15:04:05")).With("sunset", sunsetTime.Format("15:04:05")))
+	sunState = state
+}
+
 func updateSunTime() {
+	cfg := conf.Config()
 	now := time.Now()
 	_, offset := now.Zone()
 	p := sunrisesunset.Parameters{
-		Latitude:  latitude,
-		Longitude: longitude,
+		Latitude:  cfg.Location.Latitude,
+		Longitude: cfg.Location.Longitude,
 		UtcOffset: float64(offset) / 60 / 60,
 		Date:      time.Now(),
 	}
@@ -75,7 +245,9 @@ func updateSunTime() {
 	sunset = time.Date(now.Year(), now.Month(), now.Day(),
 		sunset.Hour(), sunset.Minute(), sunset.Second(), 1, now.Location())
 	log.Printf("Sunrise: %v, Sunset: %v\n", sunrise.Format("15:04:05"), sunset.Format("15:04:05"))
+	sunMu.Lock()
 	sunriseTime, sunsetTime = sunrise, sunset
+	sunMu.Unlock()
 
 	// create a time representing the coming midnight
 	midnight = now.Add(24 * time.Hour)
@@ -83,14 +255,19 @@ func updateSunTime() {
 		0, 0, 0, 0, now.Location())
 	log.Printf("Coming midnight: %v\n", midnight.Format("Mon Jan 2 15:04:05 MST 2006"))
 
-	lightOn, err = checkLight()
+	on, err := checkLight()
 	if err != nil {
 		log.Printf("Check light failed:%v\n", err)
 	}
+	lightMu.Lock()
+	lightOn = on
+	lightMu.Unlock()
 }
 
 // check if current time is during day
 func isBright() bool {
+	sunMu.Lock()
+	defer sunMu.Unlock()
 	now := time.Now()
 	if now.After(sunriseTime) && now.Before(sunsetTime) {
 		return true
@@ -99,21 +276,85 @@ func isBright() bool {
 }
 
 func main() {
-	logs.SetupSyslog("AutoLight")
-
-	// for concurrent access to light sensor
-	fileLock := flock.New("/var/lock/tsl2561.lock")
+	flag.Parse()
+	var err error
+	conf, err = configFlags.Watch(func(c *config.Config) error {
+		if err := c.AutoLight.Validate(); err != nil {
+			return err
+		}
+		if _, err := c.Device(c.AutoLight.Plug, xiaomi.CapPower); err != nil {
+			return err
+		}
+		if *simulate {
+			return nil
+		}
+		// a lamp which can't be switched has to be reported somewhere
+		n := c.Notifications()
+		return n.Check(eventLightFailed)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := conf.Config()
+	spec, err := cfg.Hardware.LightSensor()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	r := raspi.NewAdaptor()
-	lux := i2c.NewTSL2561Driver(r, i2c.WithBus(0), i2c.WithAddress(0x39), i2c.WithTSL2561Gain1X)
+	notifier = notify.NewRouter(*simulate)
 
-	// do the first sunrise/sunset calculation
+	var (
+		connections []gobot.Connection
+		devices     []gobot.Device
+		lux         sensors.Sensor
+	)
+	if *simulate {
+		gateway = xiaomi.NewSimulated()
+	} else {
+		logs.SetupSyslog("AutoLight")
+		if gateway, err = xiaomi.Open(cfg.Gateway.Address, cfg.Gateway.Token, cfg.AutoLight.MiioBinPath); err != nil {
+			log.Fatal(err)
+		}
+		if cfg.Gateway.Listen {
+			if _, err := xiaomi.ListenLAN(cfg.Gateway.Interface); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	// plug reports come from our gateway listener or door_monitor's, door
+	// openings from door_monitor
+	if cfg.BrokerSocket != "" {
+		broker.RelayEvents(cfg.BrokerSocket, "auto_light")
+	}
+	// the sun times have to be known before a door opening can switch the light
 	updateSunTime()
+	go followPlug()
+	go followDoors()
+	// the broker owns (and calibrates) the sensor when it's running
+	if cfg.BrokerSocket != "" {
+		lux = cfg.BrokerClient(spec)
+	} else {
+		var r *raspi.Adaptor
+		if !*simulate {
+			r = raspi.NewAdaptor()
+			connections = append(connections, r)
+		}
+		var device gobot.Device
+		if lux, device, err = sensors.Setup(spec, r, *simulate, cfg.Calibration, cfg.Filters); err != nil {
+			log.Fatal(err)
+		}
+		if device != nil {
+			devices = append(devices, device)
+		}
+	}
 
 	work := func() {
-		gobot.Every(10*time.Second, func() {
+		gobot.Every(cfg.AutoLight.CheckInterval, func() {
+			cfg := conf.Config()
 			// check if sun already sets
-			if !isBright() {
+			bright := isBright()
+			publishSun(bright)
+			if !bright {
 
 				// if now is past midnight, let's turn off light
 				if time.Now().After(midnight) {
@@ -126,31 +367,26 @@ func main() {
 					return
 				}
 
-				var broadband, ir uint16
-				for {
-					locked, err := fileLock.TryLock()
-					if err != nil {
-						log.Printf("Unable to lock:%v\n", err)
-						return
-					}
-					if locked {
-						// get current light measurement
-						broadband, ir, err = lux.GetLuminocity()
-						if err != nil {
-							log.Printf("read luminocity failed:%v\n", err)
-							return
-						}
-						fileLock.Unlock()
-						break
-					}
+				// get current light measurement, don't wait longer than the check interval
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.AutoLight.CheckInterval)
+				defer cancel()
+				readings, err := lux.Read(ctx)
+				if err != nil {
+					log.Printf("read luminocity failed:%v\n", err)
+					return
+				}
+				readings.Publish()
+				light, err := readings.Value(sensors.Lux)
+				if err != nil {
+					log.Printf("read luminocity failed:%v\n", err)
+					return
 				}
-				light := lux.CalculateLux(broadband, ir)
 
 				// check if light is off
-				if light <= 15 {
+				if light <= cfg.AutoLight.DarkLux {
 					// light isn't on, let's turn it on
 					turnOnLight()
-				} else if light > 120 {
+				} else if light > cfg.AutoLight.BrightLux {
 					// too bright, turn off light
 					turnOffLight()
 				}
@@ -159,8 +395,8 @@ func main() {
 	}
 
 	robot := gobot.NewRobot("auto_light_on",
-		[]gobot.Connection{r},
-		[]gobot.Device{lux},
+		connections,
+		devices,
 		work,
 	)
 
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/history"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+var configFlags = config.RegisterFlags(flag.CommandLine)
+
+var (
+	historyPath = flag.String("history", "", "history file written by door_monitor (overrides config)")
+	days        = flag.Int("days", 7, "how many days back to report, 0 for everything")
+	door        = flag.String("door", "", "only report this door")
+)
+
+func report(s *history.Stats) {
+	fmt.Printf("%s: %d openings\n", strings.Title(s.Door), s.Openings)
+	fmt.Println("  per day:")
+	for _, day := range s.Days() {
+		fmt.Printf("    %s %3d\n", day, s.PerDay[day])
+	}
+	if s.Closed > 0 {
+		fmt.Printf("  longest open: %s, from %s\n", history.Humanize(s.Longest), s.LongestStart.Format("Mon Jan 2 15:04"))
+		fmt.Printf("  average open: %s\n", history.Humanize(s.Average))
+	}
+	fmt.Println("  openings by hour:")
+	max := 0
+	for _, n := range s.ByHour {
+		if n > max {
+			max = n
+		}
+	}
+	for hour, n := range s.ByHour {
+		// bars of at most 40 characters
+		bar := 0
+		if max > 0 {
+			bar = (n*40 + max - 1) / max
+		}
+		fmt.Printf("    %02d %-40s %d\n", hour, strings.Repeat("#", bar), n)
+	}
+}
+
+// reports the door openings recorded by door_monitor
+func main() {
+	flag.Parse()
+	cfg, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := cfg.DoorMonitor.HistoryFile
+	if *historyPath != "" {
+		path = *historyPath
+	}
+	if path == "" {
+		log.Fatal("door_monitor:history_file isn't set")
+	}
+
+	var since time.Time
+	if *days > 0 {
+		today := time.Now()
+		today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+		since = today.AddDate(0, 0, 1-*days)
+	}
+	records, err := history.Read(path, since)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *door != "" {
+		// records are by device name, so an ID or alias is looked up
+		name := *door
+		if d, err := cfg.Device(*door, xiaomi.CapContact); err == nil {
+			name = d.Name
+		}
+		var filtered []history.Record
+		for _, r := range records {
+			if r.Door == name {
+				filtered = append(filtered, r)
+			}
+		}
+		records = filtered
+	}
+
+	stats := history.Compute(records)
+	if len(stats) == 0 {
+		fmt.Println("no door openings recorded")
+		return
+	}
+	for i, s := range stats {
+		if i > 0 {
+			fmt.Println()
+		}
+		report(s)
+	}
+}
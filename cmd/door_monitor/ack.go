@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/notify"
+)
+
+// notification event when a door is snoozed
+const eventDoorSnoozed = "door_snoozed"
+
+// ack is who snoozed a door's reminders until when
+type ack struct {
+	By    string
+	At    time.Time
+	Until time.Time
+}
+
+// how long a snooze link works after the notification carrying it
+const ackLinkValid = 24 * time.Hour
+
+// signature of the snooze link of a door expiring at expires (unix time)
+func ackSignature(ref string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(conf.Config().DoorMonitor.Ack.Secret))
+	fmt.Fprintf(mac, "%s|%d", ref, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ackLink returns the link to snooze a door, empty if the page is disabled
+func ackLink(ref string) string {
+	cfg := conf.Config().DoorMonitor.Ack
+	if cfg.Listen == "" {
+		return ""
+	}
+	expires := time.Now().Add(ackLinkValid).Unix()
+	q := url.Values{
+		"door":    {ref},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {ackSignature(ref, expires)},
+	}
+	return strings.TrimSuffix(cfg.URL, "/") + "/ack?" + q.Encode()
+}
+
+// validAck checks the signature and expiry of a snooze link
+func validAck(q url.Values) error {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return errors.New("invalid link")
+	}
+	if !hmac.Equal([]byte(ackSignature(q.Get("door"), expires)), []byte(q.Get("sig"))) {
+		return errors.New("invalid link")
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return errors.New("link expired")
+	}
+	return nil
+}
+
+// ackDuration parses a snooze duration, one of those offered or 0 to
+// unsnooze
+func ackDuration(s string) (time.Duration, error) {
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if dur == 0 {
+		return 0, nil
+	}
+	for _, d := range conf.Config().DoorMonitor.Ack.Snooze {
+		if dur == d {
+			return dur, nil
+		}
+	}
+	return 0, fmt.Errorf("%v isn't offered", dur)
+}
+
+var ackPage = template.Must(template.New("ack").Parse(`<!DOCTYPE html>
+<html><head><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Door}}</title></head>
+<body>
+<h2>{{.Door}} is {{if .Open}}open{{else}}closed{{end}}</h2>
+{{with .Ack}}<p>Snoozed by {{.By}} until {{.Until.Format "Mon 15:04"}}</p>{{end}}
+{{with .Message}}<p><b>{{.}}</b></p>{{end}}
+<form method="post">
+<p><label>Your name <input name="by" value="{{.By}}" required></label></p>
+<p>{{range .Snooze}}<button name="for" value="{{.}}">Snooze {{.}}</button> {{end}}
+<button name="for" value="0s">Unsnooze</button></p>
+</form>
+</body></html>
+`))
+
+// serveAck serves the page snoozing doors, identified by their device as in
+// door_monitor.doors
+func serveAck(address string, doors []*door) {
+	byRef := make(map[string]*door)
+	for _, d := range doors {
+		byRef[d.ref] = d
+	}
+	http.HandleFunc("/ack", func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("door")
+		d, ok := byRef[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if err := validAck(r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		page := struct {
+			Door    string
+			Open    bool
+			Ack     *ack
+			Message string
+			By      string
+			Snooze  []time.Duration
+		}{Door: strings.Title(d.device.Name), Snooze: conf.Config().DoorMonitor.Ack.Snooze}
+		if c, err := r.Cookie("by"); err == nil {
+			page.By = c.Value
+		}
+
+		if r.Method == http.MethodPost {
+			by := strings.TrimSpace(r.FormValue("by"))
+			dur, err := ackDuration(r.FormValue("for"))
+			if by == "" || err != nil {
+				http.Error(w, "name and duration required", http.StatusBadRequest)
+				return
+			}
+			d.snooze(by, dur)
+			http.SetCookie(w, &http.Cookie{Name: "by", Value: by, MaxAge: 365 * 24 * 3600})
+			page.By = by
+			page.Message = "Thanks " + by
+		}
+		page.Open = d.isOpen()
+		if a, ok := d.snoozed(); ok {
+			page.Ack = &a
+		}
+		if err := ackPage.Execute(w, page); err != nil {
+			log.Printf("ack page:%v\n", err)
+		}
+	})
+	log.Printf("ack page listening on %s\n", address)
+	log.Fatal(http.ListenAndServe(address, nil))
+}
+
+// snooze stops reminders of the door for dur, or cancels the snooze if 0
+func (d *door) snooze(by string, dur time.Duration) {
+	now := time.Now()
+	d.mu.Lock()
+	d.ack = &ack{By: by, At: now, Until: now.Add(dur)}
+	if dur == 0 {
+		d.ack = nil
+	}
+	d.mu.Unlock()
+	d.save()
+
+	m := notify.Message{Event: eventDoorSnoozed, Title: strings.Title(d.device.Name)}
+	if dur == 0 {
+		m.Body = fmt.Sprintf("%s reminders resumed by %s", strings.Title(d.device.Name), by)
+	} else {
+		m.Body = fmt.Sprintf("%s reminders snoozed for %v by %s", strings.Title(d.device.Name), dur, by)
+	}
+	log.Println(m.Body)
+	go d.notify(m)
+}
+
+// snoozed returns the current snooze of the door, if any
+func (d *door) snoozed() (ack, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ack == nil || time.Now().After(d.ack.Until) {
+		return ack{}, false
+	}
+	return *d.ack, true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckLink(t *testing.T) {
+	link, err := url.Parse(ackLink("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link.String(), "http://pi:8080/ack?") {
+		t.Errorf("link = %s", link)
+	}
+	q := link.Query()
+	if err := validAck(q); err != nil {
+		t.Errorf("validAck(%s):%v", link, err)
+	}
+
+	tampered := func(key, value string) url.Values {
+		c := url.Values{}
+		for k, v := range q {
+			c[k] = v
+		}
+		c.Set(key, value)
+		return c
+	}
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+	for name, q := range map[string]url.Values{
+		"another door":    tampered("door", "counted"),
+		"extended":        tampered("expires", later),
+		"no expiry":       tampered("expires", ""),
+		"wrong signature": tampered("sig", ackSignature("counted", 0)),
+	} {
+		if err := validAck(q); err == nil {
+			t.Errorf("%s:accepted", name)
+		}
+	}
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	q = url.Values{
+		"door":    {"plain"},
+		"expires": {strconv.FormatInt(expired, 10)},
+		"sig":     {ackSignature("plain", expired)},
+	}
+	if err := validAck(q); err == nil || err.Error() != "link expired" {
+		t.Errorf("expired link:%v", err)
+	}
+}
+
+func TestAckDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"30m", 30 * time.Minute, true},
+		{"1h0m0s", time.Hour, true},
+		{"0s", 0, true},
+		{"2h", 0, false},
+		{"-30m", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ackDuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ackDuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
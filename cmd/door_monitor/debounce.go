@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/notify"
+)
+
+// notification event when a contact sensor keeps flapping
+const eventSensorFaulty = "sensor_faulty"
+
+// doors whose pending change may have held long enough
+var confirmCh = make(chan *door)
+
+// pending is a contact change not taken yet
+type pending struct {
+	closed bool
+	since  time.Time
+	count  int
+}
+
+// debounce returns the current debounce settings of the door
+func (d *door) debounce() config.Debounce {
+	if settings, ok := conf.Config().Door(d.ref); ok {
+		return *settings.Debounce
+	}
+	return *d.settings.Debounce
+}
+
+// reading handles a contact reading, only updating the door once the change
+// is confirmed and the sensor isn't flapping
+func (d *door) reading(e events.Event) {
+	closed := e.New == events.Closed
+	cfg := d.debounce()
+	now := time.Now()
+	if d.last != nil && *d.last != closed {
+		d.changes = append(d.changes, now)
+	}
+	d.last = &closed
+	if d.flapping(cfg, now) {
+		return
+	}
+
+	if closed != d.isOpen() {
+		// back to what it was
+		d.pending = nil
+		return
+	}
+	if d.pending == nil || d.pending.closed != closed {
+		d.pending = &pending{closed: closed, since: now}
+		if cfg.Hold > 0 {
+			time.AfterFunc(cfg.Hold, func() { confirmCh <- d })
+		}
+	}
+	d.pending.count++
+	d.confirm()
+}
+
+// confirm updates the door if its pending change was seen often or long
+// enough
+func (d *door) confirm() {
+	p := d.pending
+	if p == nil || d.flaps {
+		return
+	}
+	cfg := d.debounce()
+	held := cfg.Hold > 0 && time.Since(p.since) >= cfg.Hold
+	counted := cfg.Readings > 1 && p.count >= cfg.Readings
+	if held || counted || (cfg.Hold == 0 && cfg.Readings <= 1) {
+		d.pending = nil
+		d.update(p.closed)
+	}
+}
+
+// flapping returns true while the sensor changed too often lately, alerting
+// once when it starts
+func (d *door) flapping(cfg config.Debounce, now time.Time) bool {
+	if cfg.FlapChanges == 0 {
+		d.changes, d.flaps = nil, false
+		return false
+	}
+	recent := d.changes[:0]
+	for _, t := range d.changes {
+		if now.Sub(t) < cfg.FlapWindow {
+			recent = append(recent, t)
+		}
+	}
+	d.changes = recent
+
+	switch {
+	case !d.flaps && len(d.changes) >= cfg.FlapChanges:
+		d.flaps, d.pending = true, nil
+		m := notify.Message{
+			Event: eventSensorFaulty,
+			Title: strings.Title(d.device.Name) + " Sensor",
+			Body: fmt.Sprintf("%s sensor may be faulty, it changed %d times within %v. Ignoring it until it settles.",
+				strings.Title(d.device.Name), len(d.changes), cfg.FlapWindow),
+		}
+		log.Println(m.Body)
+		emit(events.New(d.device.ID, events.Flapping, events.Settled, events.Faulty).
+			With("door", d.device.Name).With("changes", strconv.Itoa(len(d.changes))))
+		go d.notify(m)
+	case d.flaps && len(d.changes) == 0:
+		d.flaps = false
+		emit(events.New(d.device.ID, events.Flapping, events.Faulty, events.Settled).With("door", d.device.Name))
+	}
+	return d.flaps
+}
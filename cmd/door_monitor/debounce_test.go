@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/history"
+	"github.com/starryalley/smart_home/pkg/notify"
+)
+
+// doors of the tests, each with its own debounce settings
+const testConfig = `
+devices:
+  - {name: plain, id: 158d0000000001, model: magnet}
+  - {name: counted, id: 158d0000000002, model: magnet}
+  - {name: held, id: 158d0000000003, model: magnet}
+  - {name: flappy, id: 158d0000000004, model: magnet}
+door_monitor:
+  warning_timeout: 1h
+  ack: {listen: ":8080", url: "http://pi:8080/", secret: test, snooze: [30m, 1h]}
+  doors:
+    - {device: plain, debounce: {}}
+    - {device: counted, debounce: {readings: 2}}
+    - {device: held, debounce: {hold: 50ms}}
+    - {device: flappy, debounce: {flap_changes: 3, flap_window: 200ms}}
+`
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "door_monitor")
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		panic(err)
+	}
+	fs := flag.NewFlagSet("test", flag.PanicOnError)
+	f := config.RegisterFlags(fs)
+	fs.Parse([]string{"-config", path})
+	if conf, err = f.Watch(func(c *config.Config) error { return c.DoorMonitor.Validate() }); err != nil {
+		panic(err)
+	}
+	notifier = notify.NewRouter(true)
+	states, _ = loadState("")
+	openings = history.NewStore("")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func testDoor(t *testing.T, ref string) *door {
+	t.Helper()
+	d, err := newDoor(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func contact(d *door, state string) {
+	d.reading(events.New(d.device.ID, events.Contact, "", state))
+}
+
+func TestDebounce(t *testing.T) {
+	const (
+		open   = events.Open
+		closed = events.Closed
+	)
+	tests := []struct {
+		door     string
+		readings []string
+		// whether the door is open after each reading
+		want []bool
+	}{
+		{
+			door:     "plain",
+			readings: []string{open, closed, open},
+			want:     []bool{true, false, true},
+		},
+		{
+			door:     "counted",
+			readings: []string{open, open, closed, open, closed, closed, open, closed},
+			want:     []bool{false, true, true, true, true, false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.door, func(t *testing.T) {
+			d := testDoor(t, tt.door)
+			for i, r := range tt.readings {
+				contact(d, r)
+				if got := d.isOpen(); got != tt.want[i] {
+					t.Errorf("after reading %d (%s) open:%v, want %v", i, r, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDebounceHold(t *testing.T) {
+	d := testDoor(t, "held")
+	contact(d, events.Open)
+	if d.isOpen() {
+		t.Fatal("open before the change held")
+	}
+	select {
+	case c := <-confirmCh:
+		c.confirm()
+	case <-time.After(time.Second):
+		t.Fatal("change not confirmed")
+	}
+	if !d.isOpen() {
+		t.Error("not open once the change held")
+	}
+
+	// a change going back before the hold is dropped
+	contact(d, events.Closed)
+	contact(d, events.Open)
+	select {
+	case c := <-confirmCh:
+		c.confirm()
+	case <-time.After(time.Second):
+		t.Fatal("no confirmation")
+	}
+	if !d.isOpen() {
+		t.Error("closed by a change which didn't hold")
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	sub := events.Subscribe("test", 0, string(events.Flapping))
+	defer sub.Close()
+	d := testDoor(t, "flappy")
+
+	var got []bool
+	for _, r := range []string{events.Open, events.Closed, events.Open, events.Closed, events.Open, events.Closed} {
+		contact(d, r)
+		got = append(got, d.isOpen())
+	}
+	// the third change within the window is the sensor flapping, and the
+	// readings after it are ignored
+	if want := "[true false true true true true]"; fmt.Sprint(got) != want {
+		t.Errorf("open after each reading %v, want %s", got, want)
+	}
+	if e := <-sub.Events(); e.New != events.Faulty || e.Source != d.device.ID {
+		t.Errorf("event %v, want faulty", e)
+	}
+
+	// once it stops changing for the window it's trusted again
+	time.Sleep(300 * time.Millisecond)
+	contact(d, events.Closed)
+	if e := <-sub.Events(); e.New != events.Settled {
+		t.Errorf("event %v, want settled", e)
+	}
+	if d.isOpen() {
+		t.Error("still open after the sensor settled")
+	}
+}
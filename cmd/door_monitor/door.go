@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/history"
+	"github.com/starryalley/smart_home/pkg/notify"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+// door is the state machine of one door: closed, or open with a warning
+// pending
+type door struct {
+	// device as listed in door_monitor.doors
+	ref    string
+	device xiaomi.Device
+	// door_monitor.doors entry, kept if the door is removed from the config
+	settings config.Door
+	// closed to cancel the warning when the door closes
+	quitMon chan struct{}
+
+	// debounce state: last reading, change waiting to be confirmed, recent
+	// changes and whether the sensor is flapping
+	last    *bool
+	pending *pending
+	changes []time.Time
+	flaps   bool
+
+	// also used by the ack page
+	mu     sync.Mutex
+	opened bool
+	// time of the last transition
+	since time.Time
+	ack   *ack
+}
+
+func newDoor(ref string) (*door, error) {
+	cfg := conf.Config()
+	device, err := cfg.Device(ref, xiaomi.CapContact)
+	if err != nil {
+		return nil, err
+	}
+	settings, _ := cfg.Door(ref)
+	return &door{ref: ref, device: device, settings: settings}, nil
+}
+
+// update changes the state of the door
+func (d *door) update(closed bool) {
+	d.mu.Lock()
+	// when sensor state is different
+	if d.opened != closed {
+		d.mu.Unlock()
+		return
+	}
+	d.opened = !closed
+	openedAt, now := d.since, time.Now()
+	d.since = now
+	d.mu.Unlock()
+	d.save()
+	d.changed(closed, openedAt)
+	if settings, ok := conf.Config().Door(d.ref); ok {
+		d.settings = settings
+	}
+	if !closed {
+		// start door monitoring
+		d.quitMon = make(chan struct{})
+		go d.monitor(d.settings, now, d.quitMon)
+	} else {
+		// stop door monitoring
+		close(d.quitMon)
+		d.quitMon = nil
+	}
+}
+
+// changed emits the transition and adds it to the history, with how long the
+// door was open since openedAt when closing. A zero openedAt means it isn't
+// known.
+func (d *door) changed(closed bool, openedAt time.Time) {
+	e := events.New(d.device.ID, events.Contact, events.Closed, events.Open).With("door", d.device.Name)
+	r := history.Record{Door: d.device.Name, Open: !closed, Time: e.Time}
+	if closed {
+		e.Old, e.New = events.Open, events.Closed
+		if openedAt.IsZero() {
+			r.DurationUnknown = true
+		} else {
+			r.Duration = r.Time.Sub(openedAt)
+			e = e.With("open_for", r.Duration.Round(time.Second).String())
+		}
+	}
+	emit(e)
+	if err := openings.Append(r); err != nil {
+		log.Printf("Error recording %s history:%v\n", d.device.Name, err)
+	}
+}
+
+func (d *door) isOpen() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.opened
+}
+
+// monitor warns about the door being open after the warning timeout, then
+// reminds on the door's schedule until quit is closed. A door open for longer
+// than the warning timeout, e.g. since before a restart, is reminded about
+// right away.
+func (d *door) monitor(settings config.Door, openedAt time.Time, quit <-chan struct{}) {
+	r := settings.Reminders
+	warned := time.Since(openedAt) >= settings.WarningTimeout
+	escalated := false
+	next := openedAt.Add(settings.WarningTimeout)
+	for {
+		select {
+		case <-time.After(time.Until(next)):
+			open := time.Since(openedAt)
+			m := notify.Message{Event: eventDoorOpen, Title: settings.Title, Body: settings.Message}
+			if warned {
+				m.Body = fmt.Sprintf("%s, still open after %s", settings.Message, history.Humanize(open))
+			}
+			if r.EscalateAfter > 0 && open >= r.EscalateAfter {
+				m.Event, m.Priority, escalated = r.EscalateEvent, notify.PriorityHigh, true
+			}
+			if link := ackLink(d.ref); link != "" {
+				m.Body += "\nSnooze:" + link
+			}
+			if a, ok := d.snoozed(); ok {
+				log.Printf("%s reminder skipped, snoozed by %s until %s\n", d.device.Name, a.By, a.Until.Format("15:04"))
+			} else {
+				d.notify(m)
+				warned = true
+			}
+
+			// next reminder, or the escalation if that comes first
+			next = time.Time{}
+			if r.Every > 0 {
+				next = time.Now().Add(r.Every)
+			}
+			if escalateAt := openedAt.Add(r.EscalateAfter); r.EscalateAfter > 0 && !escalated &&
+				(next.IsZero() || escalateAt.Before(next)) {
+				next = escalateAt
+			}
+			if next.IsZero() {
+				// no more reminders, just wait for the door to close
+				<-quit
+				d.closed(settings, openedAt, warned)
+				return
+			}
+		case <-quit:
+			d.closed(settings, openedAt, warned)
+			return
+		}
+	}
+}
+
+// closed sends the follow-up once a door warned about is closed
+func (d *door) closed(settings config.Door, openedAt time.Time, warned bool) {
+	if warned && settings.Reminders.Closed {
+		d.notify(notify.Message{
+			Event: eventDoorClosed,
+			Title: settings.Title,
+			Body:  fmt.Sprintf("%s closed after %s", strings.Title(d.device.Name), history.Humanize(time.Since(openedAt))),
+		})
+	}
+	log.Printf("%s door monitor exited\n", d.device.Name)
+}
+
+func (d *door) notify(m notify.Message) {
+	if err := sendNotification(m); err != nil {
+		log.Printf("Error sending %s notification:%s\n", d.device.Name, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/notify"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+// notification events about the door sensors
+const (
+	eventDeviceOffline = "device_offline"
+	eventBatteryLow    = "battery_low"
+)
+
+// health of the door sensors, from polling and gateway events
+var health = xiaomi.NewHealthMonitor()
+
+// how often the door sensors' health is checked, separately from polling
+// so it's checked when only listening to gateway events too
+const healthInterval = time.Minute
+
+// alerts sent and not yet cleared, by kind and device ID. Only used by the
+// sensor updater.
+var healthAlerts = make(map[string]bool)
+
+// readVoltages reads the battery voltage of every door sensor
+func readVoltages(doors []*door) {
+	for _, d := range doors {
+		mV, err := xiaomi.GetVoltage(gateway, d.device.ID)
+		if err != nil {
+			log.Printf("Error getting %s battery voltage:%s\n", d.device.Name, err)
+			continue
+		}
+		health.Voltage(d.device.ID, mV)
+	}
+}
+
+// checkHealth alerts once about sensors going offline or running low on
+// battery, and when they're back
+func checkHealth(doors []*door) {
+	cfg := conf.Config().DoorMonitor.Health
+	for _, d := range doors {
+		h := health.Get(d.device.ID)
+		name := strings.Title(d.device.Name)
+		title := name + " Sensor"
+
+		offline := cfg.OfflineAfter > 0 && h.Unreachable(cfg.OfflineAfter)
+		key := eventDeviceOffline + "/" + d.device.ID
+		switch {
+		case offline && !healthAlerts[key]:
+			healthAlerts[key] = true
+			emit(events.New(d.device.ID, events.Reachability, events.Online, events.Offline).
+				With("door", d.device.Name).With("failures", strconv.Itoa(h.Failures)).With("error", h.LastError))
+			last := "never heard from since " + h.Since.Format("Jan 2 15:04")
+			if !h.LastSuccess.IsZero() {
+				last = "last heard from " + h.LastSuccess.Format("Jan 2 15:04")
+			}
+			if h.Failures > 0 {
+				last += fmt.Sprintf(", %d failed reads (%s)", h.Failures, h.LastError)
+			}
+			alertHealth(d, notify.Message{
+				Event:    eventDeviceOffline,
+				Title:    title,
+				Body:     fmt.Sprintf("%s sensor is offline, %s. The door may be open without us knowing.", name, last),
+				Priority: notify.PriorityHigh,
+			})
+		case !offline && healthAlerts[key]:
+			delete(healthAlerts, key)
+			emit(events.New(d.device.ID, events.Reachability, events.Offline, events.Online).With("door", d.device.Name))
+			alertHealth(d, notify.Message{Event: eventDeviceOffline, Title: title, Body: name + " sensor is back online"})
+		}
+
+		low := cfg.LowBattery > 0 && h.Voltage > 0 && h.Voltage < cfg.LowBattery
+		key = eventBatteryLow + "/" + d.device.ID
+		switch {
+		case low && !healthAlerts[key]:
+			healthAlerts[key] = true
+			emit(events.New(d.device.ID, events.Battery, "", strconv.Itoa(h.Voltage)).With("door", d.device.Name).With("low", "true"))
+			alertHealth(d, notify.Message{
+				Event: eventBatteryLow,
+				Title: title,
+				Body:  fmt.Sprintf("%s sensor battery is low, %.2fV", name, float64(h.Voltage)/1000),
+			})
+		case !low && h.Voltage > 0 && healthAlerts[key]:
+			delete(healthAlerts, key)
+			log.Printf("%s battery back to %.2fV\n", d.device.Name, float64(h.Voltage)/1000)
+		}
+	}
+}
+
+func alertHealth(d *door, m notify.Message) {
+	log.Println(m.Body)
+	go d.notify(m)
+}
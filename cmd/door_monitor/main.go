@@ -1,135 +1,251 @@
 package main
 
 import (
-	"fmt"
+	"flag"
 	"log"
-	"path"
 	"time"
 
-	"github.com/scotow/notigo"
-
-	"github.com/starryalley/smart_home/pkg/cmds"
+	"github.com/starryalley/smart_home/pkg/broker"
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/history"
 	"github.com/starryalley/smart_home/pkg/logs"
+	"github.com/starryalley/smart_home/pkg/notify"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
 )
 
-// for RPi
-//const binPath = "/usr/local/lib/nodejs/bin/"
-const binPath = "/usr/local/bin/"
+var simulate = flag.Bool("sim", false, "use a simulated gateway and log notifications instead of sending them")
+var statePath = flag.String("state", "", "file keeping door states across restarts (overrides config)")
+var historyPath = flag.String("history", "", "file every opening and closing is appended to (overrides config)")
+var configFlags = config.RegisterFlags(flag.CommandLine)
 
-// rear door sensor IDs: enter your MIIO device ID
-const doorSensorID = "158d0002676aec"
+// current config, reloaded when the file changes
+var conf *config.Watcher
 
-// update sensor state in this interval
-const checkInterval = 30 * time.Second
+// notification events
+const (
+	eventDoorOpen   = "door_open"
+	eventDoorClosed = "door_closed"
+)
 
-// how long if door is left open is considered a warning
-const doorOpenWarningTimeout = 2 * time.Minute
+// gateway client to query the door sensors
+var gateway xiaomi.Client
 
-// IFTTT: enter your IFTTT webhook key and event name below
-const iftttKey = "your_ifttt_key"
-const iftttEventName = "your_ifttt_webhook_event"
+func getMagnetSensorContact(sensorID string) (bool, error) {
+	return xiaomi.GetBool(gateway, sensorID, "contact")
+}
 
-// true if door is opened, false if closed
-var doorOpened bool
+// emit publishes an event about the doors
+func emit(e events.Event) {
+	log.Printf("Event:%v\n", e)
+	events.Publish(e)
+}
 
-func getMagnetSensorContact(sensorID string) (bool, error) {
-	outs, err := cmds.RunCmdWithResult(fmt.Sprintf("%s %s control %s contact", path.Join(binPath, "node"), path.Join(binPath, "miio"), doorSensorID))
-	if err != nil {
-		return false, err
+// updateSensorState polls the door sensors, or only every fallback interval
+// when gateway events come in over multicast (lan isn't nil). Contact
+// readings are sent to eventCh. The sensors' health is checked every
+// healthInterval either way.
+func updateSensorState(doors []*door, eventCh chan<- events.Event, lan *xiaomi.Listener, quit <-chan struct{}) {
+	log.Printf("door sensor updater started\n")
+	var lanEvents <-chan xiaomi.Event
+	if lan != nil {
+		lanEvents = lan.Events()
 	}
-	if len(outs) == 3 {
-		//log.Printf("magnet sensor contact:%s\n", outs[1])
-		if string(outs[1]) == "true" {
-			return true, nil
-		}
-		if string(outs[1]) == "false" {
-			return false, nil
+	// how long until the next poll, re-read after every poll so reloads are
+	// picked up
+	interval := func() time.Duration {
+		if lanEvents != nil {
+			return conf.Config().DoorMonitor.FallbackInterval
 		}
-		return false, fmt.Errorf("Unexpected sensor output:%v", outs[1])
+		return conf.Config().DoorMonitor.CheckInterval
 	}
-	return false, fmt.Errorf("Unexpected miio command output:%v", outs)
-}
-
-func updateSensorState(eventCh chan<- string, quit <-chan struct{}) {
-	log.Printf("door sensor updater started\n")
+	// one timer for all loop passes, so gateway events don't keep putting
+	// off the fallback poll
+	poll := time.NewTimer(interval())
+	defer poll.Stop()
+	healthTicker := time.NewTicker(healthInterval)
+	defer healthTicker.Stop()
+	var nextBattery time.Time
 	for {
 		select {
 		case <-quit:
 			log.Printf("door sensor updater exited\n")
 			return
-		case <-time.After(checkInterval):
-			closed, err := getMagnetSensorContact(doorSensorID)
-			if err != nil {
-				log.Printf("Error getting sensor state:%s\n", err)
-				// ignore for now
+		case e, ok := <-lanEvents:
+			if !ok {
+				log.Printf("gateway listener closed, back to polling\n")
+				lanEvents = nil
 				continue
 			}
-			// when sensor state is different
-			if doorOpened == closed {
-				if doorOpened {
-					eventCh <- "door_closed"
-				} else {
-					eventCh <- "door_opened"
+			health.Observe(e)
+			for _, t := range e.Typed() {
+				if t.Kind == events.Contact {
+					eventCh <- t
 				}
-				doorOpened = !doorOpened
 			}
+		case <-poll.C:
+			for _, d := range doors {
+				closed, err := getMagnetSensorContact(d.device.ID)
+				if err != nil {
+					log.Printf("Error getting %s sensor state:%s\n", d.device.Name, err)
+					health.Failure(d.device.ID, err)
+					continue
+				}
+				health.Success(d.device.ID)
+				state := events.Open
+				if closed {
+					state = events.Closed
+				}
+				eventCh <- events.New(d.device.ID, events.Contact, "", state).With("cmd", "poll")
+			}
+			poll.Reset(interval())
+		case <-healthTicker.C:
+			cfg := conf.Config().DoorMonitor
+			if cfg.Health.LowBattery > 0 && !time.Now().Before(nextBattery) {
+				readVoltages(doors)
+				nextBattery = time.Now().Add(cfg.Health.BatteryInterval)
+			}
+			checkHealth(doors)
 		}
 	}
 }
 
-func sendNotification(title, message string) error {
-	notification := notigo.NewNotification(title, message)
-	key := notigo.Key(iftttKey)
+// door states kept across restarts
+var states *stateFile
+
+// openings and closings of every door
+var openings *history.Store
+
+// sends notifications, rate limited and held back in quiet hours
+var notifier *notify.Router
 
-	err := key.SendEvent(notification, iftttEventName)
+// sendNotification sends m to the notifiers of its event
+func sendNotification(m notify.Message) error {
+	notifier.Update(conf.Config().Notifications())
+	return notifier.Send(m)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	conf, err = configFlags.Watch(func(c *config.Config) error {
+		if err := c.DoorMonitor.Validate(); err != nil {
+			return err
+		}
+		for _, d := range c.DoorMonitor.Doors {
+			if _, err := c.Device(d.Device, xiaomi.CapContact); err != nil {
+				return err
+			}
+		}
+		if *simulate {
+			return nil
+		}
+		// check every event has somewhere to go
+		events := []string{eventDoorOpen, eventDoorClosed}
+		if c.DoorMonitor.Health.OfflineAfter > 0 {
+			events = append(events, eventDeviceOffline)
+		}
+		if c.DoorMonitor.Health.LowBattery > 0 {
+			events = append(events, eventBatteryLow)
+		}
+		for _, d := range c.DoorMonitor.Doors {
+			if settings, _ := c.Door(d.Device); settings.Debounce.FlapChanges > 0 {
+				events = append(events, eventSensorFaulty)
+				break
+			}
+		}
+		if c.DoorMonitor.Ack.Listen != "" {
+			events = append(events, eventDoorSnoozed)
+		}
+		for _, d := range c.DoorMonitor.Doors {
+			settings, _ := c.Door(d.Device)
+			if settings.Reminders.EscalateEvent != "" {
+				events = append(events, settings.Reminders.EscalateEvent)
+			}
+		}
+		n := c.Notifications()
+		for _, event := range events {
+			if err := n.Check(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		log.Fatal(err)
+	}
+	notifier = notify.NewRouter(*simulate)
+	if *simulate {
+		gateway = xiaomi.NewSimulated()
+	} else {
+		logs.SetupSyslog("DoorMonitor")
+		cfg := conf.Config()
+		if gateway, err = xiaomi.Open(cfg.Gateway.Address, cfg.Gateway.Token, cfg.DoorMonitor.MiioBinPath); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	log.Println("Notification sent through IFTTT")
-	return nil
-}
+	// door openings go to auto_light and the others through the broker
+	if cfg := conf.Config(); cfg.BrokerSocket != "" {
+		defer broker.RelayEvents(cfg.BrokerSocket, "door_monitor").Close()
+	}
 
-func monitorDoor(quit <-chan struct{}) {
-	select {
-	case <-time.After(doorOpenWarningTimeout):
-		if err := sendNotification("Rear Door Warning", "Door left open for too long"); err != nil {
-			log.Printf("Error sending notification:%s\n", err)
+	var lan *xiaomi.Listener
+	if cfg := conf.Config().Gateway; cfg.Listen && !*simulate {
+		if lan, err = xiaomi.ListenLAN(cfg.Interface); err != nil {
+			log.Fatal(err)
 		}
-	case <-quit:
+		defer lan.Close()
+		log.Printf("listening to gateway events, polling every %v as fallback\n", conf.Config().DoorMonitor.FallbackInterval)
 	}
-	log.Println("door monitor exited")
-}
 
-func main() {
-	logs.SetupSyslog("DoorMonitor")
+	path := conf.Config().DoorMonitor.StateFile
+	if *statePath != "" {
+		path = *statePath
+	}
+	if states, err = loadState(path); err != nil {
+		log.Fatal(err)
+	}
+	path = conf.Config().DoorMonitor.HistoryFile
+	if *historyPath != "" {
+		path = *historyPath
+	}
+	openings = history.NewStore(path)
+
+	// doors are only picked up at startup, their settings on every change
+	var doors []*door
+	for _, settings := range conf.Config().DoorMonitor.Doors {
+		d, err := newDoor(settings.Device)
+		if err != nil {
+			log.Fatal(err)
+		}
+		doors = append(doors, d)
+		log.Printf("monitoring %v\n", d.device)
+		d.restore(getMagnetSensorContact(d.device.ID))
+	}
 
-	eventCh := make(chan string)
+	if address := conf.Config().DoorMonitor.Ack.Listen; address != "" {
+		go serveAck(address, doors)
+	}
+
+	eventCh := make(chan events.Event)
 	quitCh := make(chan struct{})
 	defer close(quitCh)
 
 	// start sensor updater
-	go updateSensorState(eventCh, quitCh)
+	go updateSensorState(doors, eventCh, lan, quitCh)
 
 	// wait for event to happen
-	var quitMonCh chan struct{}
 	for {
 		select {
-		case event := <-eventCh:
-			log.Printf("Event:%s\n", event)
-			if event == "door_opened" {
-				// start door monitoring
-				if quitMonCh == nil {
-					quitMonCh = make(chan struct{})
-				}
-				go monitorDoor(quitMonCh)
-			} else if event == "door_closed" {
-				// stop door monitoring
-				if quitMonCh != nil {
-					close(quitMonCh)
-					quitMonCh = nil
+		case e := <-eventCh:
+			for _, d := range doors {
+				if d.device.ID == e.Source {
+					d.reading(e)
 				}
 			}
+		case d := <-confirmCh:
+			d.confirm()
 		}
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// doorState is what is kept of a door across restarts
+type doorState struct {
+	Open bool `json:"open"`
+	// time of the last transition
+	Since time.Time `json:"since"`
+	Ack   *ack      `json:"ack,omitempty"`
+}
+
+// stateFile keeps the state of every door on disk, by device as in
+// door_monitor.doors
+type stateFile struct {
+	path string
+
+	mu    sync.Mutex
+	doors map[string]doorState
+}
+
+// loadState reads the state saved at path, nothing is saved if path is empty
+func loadState(path string) (*stateFile, error) {
+	f := &stateFile{path: path, doors: make(map[string]doorState)}
+	if path == "" {
+		return f, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.doors); err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	return f, nil
+}
+
+func (f *stateFile) get(ref string) (doorState, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.doors[ref]
+	return s, ok
+}
+
+// set saves the state of a door, replacing the file so it's never left half
+// written
+func (f *stateFile) set(ref string, s doorState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.doors[ref] = s
+	if f.path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(f.doors, "", "  ")
+	if err != nil {
+		log.Printf("Error saving door state:%v\n", err)
+		return
+	}
+	tmp := f.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		log.Printf("Error saving door state:%v\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		log.Printf("Error saving door state:%v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		log.Printf("Error saving door state:%v\n", err)
+	}
+}
+
+// save records the current state of the door
+func (d *door) save() {
+	d.mu.Lock()
+	s := doorState{Open: d.opened, Since: d.since, Ack: d.ack}
+	d.mu.Unlock()
+	states.set(d.ref, s)
+}
+
+// restore picks up the state saved before a restart, reconciled with a
+// fresh contact reading or err if it failed. A door still open is counted
+// from when it was opened.
+func (d *door) restore(closed bool, err error) {
+	s, ok := states.get(d.ref)
+	if !ok {
+		if err == nil {
+			d.update(closed)
+		}
+		return
+	}
+	d.mu.Lock()
+	d.ack = s.Ack
+	d.mu.Unlock()
+	if err != nil {
+		log.Printf("Error getting %s sensor state:%s, assuming nothing changed\n", d.device.Name, err)
+		closed = !s.Open
+	}
+
+	switch {
+	case s.Open && !closed:
+		log.Printf("%s open since %s\n", d.device.Name, s.Since.Format("Jan 2 15:04:05"))
+		d.mu.Lock()
+		d.opened, d.since = true, s.Since
+		d.mu.Unlock()
+		d.quitMon = make(chan struct{})
+		go d.monitor(d.settings, s.Since, d.quitMon)
+	case s.Open && closed:
+		// when it closed isn't known, so neither is how long it was open
+		log.Printf("%s closed while not monitored\n", d.device.Name)
+		d.mu.Lock()
+		d.since = time.Now()
+		d.mu.Unlock()
+		d.save()
+		d.changed(true, time.Time{})
+	case !s.Open && !closed:
+		// opened while not monitored, we can only count from now
+		d.update(closed)
+	default:
+		d.mu.Lock()
+		d.since = s.Since
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/platforms/raspi"
+
+	"github.com/starryalley/smart_home/pkg/broker"
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/logs"
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+var (
+	simulate    = flag.Bool("sim", false, "use simulated sensors instead of Raspberry Pi hardware")
+	socketPath  = flag.String("socket", "", "unix socket to serve sensor readings on (overrides config)")
+	configFlags = config.RegisterHardwareFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	cfg, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *socketPath != "" {
+		cfg.SensorBroker.Socket = *socketPath
+	}
+	if err := cfg.SensorBroker.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		connections []gobot.Connection
+		devices     []gobot.Device
+		r           *raspi.Adaptor
+	)
+	if !*simulate {
+		logs.SetupSyslog("SensorBroker")
+		r = raspi.NewAdaptor()
+		connections = append(connections, r)
+	}
+
+	server := broker.NewServer()
+	for _, spec := range cfg.Hardware.Sensors {
+		sensor, device, err := sensors.Setup(spec, r, *simulate, cfg.Calibration, cfg.Filters)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if device != nil {
+			devices = append(devices, device)
+		}
+		interval := cfg.SensorBroker.Interval
+		if spec.Kind == sensors.KindDHT22 {
+			interval = cfg.SensorBroker.DHTInterval
+		}
+		server.Add(sensor, interval)
+	}
+
+	work := func() {
+		go func() {
+			if err := server.Serve(cfg.SensorBroker.Socket); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	robot := gobot.NewRobot("SensorBrokerBot",
+		connections,
+		devices,
+		work,
+	)
+
+	robot.Start()
+	server.Close()
+}
@@ -1,102 +1,206 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/gofrs/flock"
-
 	"gobot.io/x/gobot"
-	"gobot.io/x/gobot/drivers/i2c"
 	"gobot.io/x/gobot/platforms/raspi"
+	"google.golang.org/api/sheets/v4"
 
+	"github.com/starryalley/smart_home/pkg/broker"
+	"github.com/starryalley/smart_home/pkg/comfort"
+	"github.com/starryalley/smart_home/pkg/config"
 	"github.com/starryalley/smart_home/pkg/logs"
+	"github.com/starryalley/smart_home/pkg/notify"
 	"github.com/starryalley/smart_home/pkg/sensors"
 )
 
-const (
-	maxRetry              = 3
-	updateInterval        = 10                                                        // update interval in minutes
-	googleSheetCredential = "/home/starryalley/.secret/google_sheet_credentials.json" // google sheet credential json file
-)
+// columns after the timestamp in the sheet, followed by the comfort zone.
+// Quantities not measured by the configured sensors or rejected by a filter
+// are left blank.
+var columns = []sensors.Quantity{
+	sensors.Temperature,
+	sensors.Humidity,
+	sensors.Broadband,
+	sensors.Infrared,
+	sensors.Lux,
+	sensors.DewPoint,
+	sensors.HeatIndex,
+	sensors.AbsoluteHumidity,
+	sensors.Pressure,
+}
+
+// notification event when a row couldn't be uploaded
+const eventUploadFailed = "sheet_upload_failed"
+
+var simulate = flag.Bool("sim", false, "use simulated sensors and log rows instead of uploading to google sheet")
+var configFlags = config.RegisterSensorFlags(flag.CommandLine)
 
 // =============================
 
-func main() {
-	logs.SetupSyslog("SensorLogger")
+// sends alerts, rate limited and held back in quiet hours
+var notifier *notify.Router
 
-	// possible multi-process access to those hardware
-	fileLockLight := flock.New("/var/lock/tsl2561.lock")
-	fileLockTemp := flock.New("/var/lock/dht22.lock")
+// alert sends m to the notifiers of its event
+func alert(cfg *config.Config, m notify.Message) {
+	notifier.Update(cfg.Notifications())
+	if err := notifier.Send(m); err != nil {
+		log.Printf("Notification failed:%v\n", err)
+	}
+}
 
-	// initialise google sheet
-	service, err := InitGoogleSheet(googleSheetCredential)
+func main() {
+	flag.Parse()
+	conf, err := configFlags.Watch(func(c *config.Config) error {
+		if err := c.SensorLogger.Validate(); err != nil {
+			return err
+		}
+		if *simulate {
+			return nil
+		}
+		// failed uploads have to be sent somewhere
+		n := c.Notifications()
+		return n.Check(eventUploadFailed)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	notifier = notify.NewRouter(*simulate)
+	cfg := conf.Config()
+	hw := cfg.Hardware
+	luxSpec, err := hw.LightSensor()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dhtSpec, err := hw.TemperatureSensor()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// setup gobot
-	r := raspi.NewAdaptor()
-	lux := i2c.NewTSL2561Driver(r, i2c.WithBus(0), i2c.WithAddress(0x39), i2c.WithTSL2561Gain1X)
+	var (
+		connections []gobot.Connection
+		devices     []gobot.Device
+		lux, dht    sensors.Sensor
+		service     *sheets.Service
+	)
+	if !*simulate {
+		logs.SetupSyslog("SensorLogger")
+
+		// initialise google sheet
+		service, err = InitGoogleSheet(cfg.SensorLogger.Credentials)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the broker owns (and calibrates and filters) the sensors when it's running,
+	// and relays the events between the commands
+	if cfg.BrokerSocket != "" {
+		broker.RelayEvents(cfg.BrokerSocket, "sensor_logger")
+		lux = cfg.BrokerClient(luxSpec)
+		dht = cfg.BrokerClient(dhtSpec)
+	} else {
+		// setup gobot
+		var r *raspi.Adaptor
+		if !*simulate {
+			r = raspi.NewAdaptor()
+			connections = append(connections, r)
+		}
+		var luxDevice, dhtDevice gobot.Device
+		if lux, luxDevice, err = sensors.Setup(luxSpec, r, *simulate, cfg.Calibration, cfg.Filters); err != nil {
+			log.Fatal(err)
+		}
+		if dht, dhtDevice, err = sensors.Setup(dhtSpec, r, *simulate, cfg.Calibration, cfg.Filters); err != nil {
+			log.Fatal(err)
+		}
+		for _, device := range []gobot.Device{luxDevice, dhtDevice} {
+			if device != nil {
+				devices = append(devices, device)
+			}
+		}
+	}
 
 	work := func() {
-		gobot.Every(updateInterval*time.Minute, func() {
+		gobot.Every(cfg.SensorLogger.UpdateInterval, func() {
+			cfg := conf.Config()
 			now := time.Now()
-			temp, hum, err := sensors.GetTempHum(fileLockTemp)
+			ctx, cancel := context.WithTimeout(context.Background(), sensors.DefaultReadTimeout)
+			defer cancel()
+			tempReadings, err := dht.Read(ctx)
 			if err != nil {
 				log.Printf("read temperature failed:%v\n", err)
 				return
 			}
-			var broadband, ir uint16
-			for {
-				locked, err := fileLockLight.TryLock()
-				if err != nil {
-					log.Printf("unable to lock for light sensor:%v\n", err)
-					time.Sleep(500 * time.Millisecond)
+			lightReadings, err := lux.Read(ctx)
+			if err != nil {
+				log.Printf("read luminocity failed:%v\n", err)
+				return
+			}
+			readings := append(tempReadings, lightReadings...)
+			readings = append(readings, comfort.Derive(readings)...)
+			var values []interface{}
+			var logged []string
+			for _, q := range columns {
+				r, ok := readings.Get(q)
+				if !ok {
+					values = append(values, "")
 					continue
 				}
-				if locked {
-					broadband, ir, err = lux.GetLuminocity()
-					fileLockLight.Unlock()
-					if err != nil {
-						log.Printf("read luminocity failed:%v\n", err)
-						return
-					}
-					break
+				// a rejected sample leaves its cell blank, the rest of the
+				// row is still logged
+				v, err := readings.Value(q)
+				if err != nil {
+					log.Println(err)
+					values = append(values, "")
+					continue
 				}
+				values = append(values, v)
+				logged = append(logged, r.String())
+			}
+			zone, err := comfort.ZoneOf(readings)
+			if err != nil {
+				log.Println(err)
 			}
-			light := lux.CalculateLux(broadband, ir)
+			values = append(values, string(zone))
+			log.Printf("%s zone:%s\n", strings.Join(logged, " "), zone)
 
-			log.Printf("T:%.01f°C H:%.01f%% BB:%v IR:%v Lux:%v\n",
-				temp, hum, broadband, ir, light)
+			if *simulate {
+				log.Printf("[sim] Row:%v %v\n", now, values)
+				return
+			}
 
 			// update to google sheet in a goroutine
 			go func() {
-				for i := 0; i < maxRetry; {
-					row := []interface{}{
+				for i := 0; i < cfg.SensorLogger.MaxRetry; {
+					row := append([]interface{}{
 						now, //.Format("2006.01.02 15:04:05"),
-						temp,
-						hum,
-						broadband,
-						ir,
-						light,
-					}
-					err = PrependRow(service, "15Zyy0_swv2YazuL9UdZ4YYkPfaIwTpPNtPHLAlsLtcY", "RawData!A2:F2", row)
+					}, values...)
+					rangeA1 := fmt.Sprintf("%s!A2:%c2", cfg.SensorLogger.Sheet, 'A'+len(row)-1)
+					err = PrependRow(service, cfg.SensorLogger.SpreadsheetID, rangeA1, row)
 					if err != nil {
 						log.Println(err)
 						i++
 					} else {
-						break
+						return
 					}
 				}
+				alert(cfg, notify.Message{
+					Event: eventUploadFailed,
+					Title: "Sensor Logger",
+					Body:  fmt.Sprintf("Uploading to google sheet failed %d times:%v", cfg.SensorLogger.MaxRetry, err),
+				})
 			}()
 
 		})
 	}
 
 	robot := gobot.NewRobot("SensorLoggerBot",
-		[]gobot.Connection{r},
-		[]gobot.Device{lux},
+		connections,
+		devices,
 		work,
 	)
 
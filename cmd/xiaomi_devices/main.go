@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/starryalley/smart_home/pkg/config"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+var configFlags = config.RegisterFlags(flag.CommandLine)
+
+var (
+	gatewayAddr = flag.String("gateway", "", "gateway IP address to ask for its devices (overrides gateway.address)")
+	wait        = flag.Duration("wait", 0, "also listen this long for gateway heartbeats, which every device sends within an hour")
+	timeout     = flag.Duration("timeout", 2*time.Second, "how long to wait for each gateway reply")
+)
+
+// lists the configured gateway sub-devices merged with the ones discovered,
+// as a devices section to paste in the config file
+func main() {
+	flag.Parse()
+	cfg, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	registry := append(xiaomi.Registry{}, cfg.Devices...)
+
+	address := cfg.Gateway.Address
+	if *gatewayAddr != "" {
+		address = *gatewayAddr
+	}
+	if address != "" {
+		found, err := xiaomi.Discover(address, *timeout)
+		if err != nil {
+			log.Printf("discover failed:%v\n", err)
+		}
+		for _, d := range found {
+			if registry.Observe(xiaomi.Event{SID: d.ID, Model: d.Model}) {
+				log.Printf("discovered %v\n", d)
+			}
+		}
+	}
+
+	if *wait > 0 {
+		lan, err := xiaomi.ListenLAN(cfg.Gateway.Interface)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("listening for gateway heartbeats for %v\n", *wait)
+		timeout := time.After(*wait)
+	listen:
+		for {
+			select {
+			case e := <-lan.Events():
+				if registry.Observe(e) {
+					log.Printf("discovered %s %s\n", e.Model, e.SID)
+				}
+			case <-timeout:
+				break listen
+			}
+		}
+		lan.Close()
+	}
+
+	for _, d := range registry {
+		log.Printf("%-20s %-16s %-18s %v\n", d.Name, d.ID, d.Model, d.Capabilities())
+	}
+	out, err := yaml.Marshal(struct {
+		Devices xiaomi.Registry `yaml:"devices"`
+	}{registry})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprint(os.Stdout, string(out))
+}
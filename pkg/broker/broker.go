@@ -0,0 +1,194 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+// DefaultSocket is where the broker listens by default
+const DefaultSocket = "/var/run/sensor_broker.sock"
+
+// Request asks the broker for the latest readings of a sensor, or passes
+// events between commands (see RelayEvents)
+type Request struct {
+	Sensor string `json:"sensor,omitempty"`
+	// an event for the subscribers, answered with an empty Response
+	Publish *events.Event `json:"publish,omitempty"`
+	// a stream of events, one JSON event per line for as long as the
+	// connection is open
+	Subscribe *Subscribe `json:"subscribe,omitempty"`
+}
+
+// Subscribe asks for the events of topics, every event if empty. The latest
+// event of each of the Retained topics is sent first, e.g. whether it's day
+// or night.
+type Subscribe struct {
+	// who's asking, for the logs
+	Name     string   `json:"name"`
+	Topics   []string `json:"topics,omitempty"`
+	Retained []string `json:"retained,omitempty"`
+}
+
+// Response carries the cached readings of a sensor and how old they are. If
+// the last read failed Error is set, along with the last good readings if any.
+type Response struct {
+	Readings sensors.Readings `json:"readings,omitempty"`
+	Age      time.Duration    `json:"age"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type entry struct {
+	sensor   sensors.Sensor
+	interval time.Duration
+
+	mu       sync.Mutex
+	readings sensors.Readings
+	updated  time.Time
+	err      error
+}
+
+func (e *entry) poll(ctx context.Context) {
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, sensors.DefaultReadTimeout)
+		readings, err := e.sensor.Read(readCtx)
+		cancel()
+		e.mu.Lock()
+		if err != nil {
+			log.Printf("read %s failed:%v\n", e.sensor.Name(), err)
+			e.err = err
+		} else {
+			e.readings, e.updated, e.err = readings, time.Now(), nil
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+func (e *entry) response() Response {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.readings == nil {
+		if e.err != nil {
+			return Response{Error: e.err.Error()}
+		}
+		return Response{Error: "no reading yet"}
+	}
+	resp := Response{Readings: e.readings, Age: time.Since(e.updated)}
+	// the readings are kept for their age but the failure isn't hidden
+	if e.err != nil {
+		resp.Error = fmt.Sprintf("%v (last reading %v old)", e.err, resp.Age.Round(time.Second))
+	}
+	return resp
+}
+
+// Server owns the sensors, polls each one on its own schedule and serves the
+// latest readings over a Unix socket. It also passes the events published by
+// each command on to the others.
+type Server struct {
+	entries map[string]*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	bus *events.Bus
+	mu  sync.Mutex
+	// latest event of each topic
+	latest map[string]events.Event
+}
+
+// NewServer creates an empty broker
+func NewServer() *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		entries: make(map[string]*entry),
+		ctx:     ctx,
+		cancel:  cancel,
+		bus:     events.NewBus(),
+		latest:  make(map[string]events.Event),
+	}
+}
+
+// Add registers a sensor to be polled every interval
+func (s *Server) Add(sensor sensors.Sensor, interval time.Duration) {
+	s.entries[sensor.Name()] = &entry{sensor: sensor, interval: interval}
+}
+
+// Serve starts polling all sensors and answers requests on socketPath until Close is called
+func (s *Server) Serve(socketPath string) error {
+	os.Remove(socketPath)
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	// every local user may read the sensors
+	if err := os.Chmod(socketPath, 0666); err != nil {
+		return err
+	}
+
+	for _, e := range s.entries {
+		go e.poll(s.ctx)
+	}
+	go func() {
+		<-s.ctx.Done()
+		l.Close()
+	}()
+
+	log.Printf("sensor broker listening on %s\n", socketPath)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops polling and serving
+func (s *Server) Close() {
+	s.cancel()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var req Request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		log.Printf("bad request:%v\n", err)
+		return
+	}
+	if req.Subscribe != nil {
+		s.stream(conn, req.Subscribe)
+		return
+	}
+	resp := Response{Error: fmt.Sprintf("unknown sensor:%s", req.Sensor)}
+	if req.Publish != nil {
+		s.publish(*req.Publish)
+		resp = Response{}
+	} else if e, ok := s.entries[req.Sensor]; ok {
+		resp = e.response()
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("unable to send response:%v\n", err)
+	}
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+// Client reads a sensor through the broker. It implements sensors.Sensor.
+type Client struct {
+	socketPath string
+	sensor     string
+	// MaxAge rejects cached readings older than this, if non-zero
+	MaxAge time.Duration
+}
+
+// NewClient creates a client reading the named sensor from the broker at socketPath
+func NewClient(socketPath, sensor string) *Client {
+	return &Client{socketPath: socketPath, sensor: sensor}
+}
+
+// Name returns the sensor ID
+func (c *Client) Name() string {
+	return c.sensor
+}
+
+// Read returns the latest readings cached by the broker
+func (c *Client) Read(ctx context.Context) (sensors.Readings, error) {
+	resp, err := c.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxAge > 0 && resp.Age > c.MaxAge {
+		return nil, fmt.Errorf("%s reading is %v old", c.sensor, resp.Age.Round(time.Second))
+	}
+	return resp.Readings, nil
+}
+
+// Get returns the broker's full response including the age of the readings
+func (c *Client) Get(ctx context.Context) (*Response, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	if err := json.NewEncoder(conn).Encode(Request{Sensor: c.sensor}); err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
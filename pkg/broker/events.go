@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+)
+
+// publish passes e on to the subscribers and keeps it as the latest of its
+// topic
+func (s *Server) publish(e events.Event) {
+	s.mu.Lock()
+	s.latest[e.Topic()] = e
+	s.mu.Unlock()
+	s.bus.Publish(e)
+}
+
+// stream sends the events a command subscribed to until it hangs up
+func (s *Server) stream(conn net.Conn, req *Subscribe) {
+	conn.SetDeadline(time.Time{})
+	sub := s.bus.Subscribe(req.Name, 0, req.Topics...)
+	// the subscriber sends nothing more, reading only notices it's gone
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		sub.Close()
+	}()
+	log.Printf("%s subscribed to events\n", req.Name)
+
+	enc := json.NewEncoder(conn)
+	send := func(e events.Event) bool {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := enc.Encode(e); err != nil {
+			sub.Close()
+			return false
+		}
+		return true
+	}
+	for _, e := range s.retained(req.Retained) {
+		if !send(e) {
+			return
+		}
+	}
+	for e := range sub.Events() {
+		if !send(e) {
+			break
+		}
+	}
+	log.Printf("%s unsubscribed from events\n", req.Name)
+}
+
+// retained returns the latest event of every topic matching one of topics,
+// either kinds or full topics
+func (s *Server) retained(topics []string) []events.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var retained []events.Event
+	for topic, e := range s.latest {
+		for _, t := range topics {
+			if t == string(e.Kind) || t == topic {
+				retained = append(retained, e)
+				break
+			}
+		}
+	}
+	sort.Slice(retained, func(i, j int) bool { return retained[i].Time.Before(retained[j].Time) })
+	return retained
+}
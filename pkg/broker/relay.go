@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+)
+
+// MetaFrom is the event metadata naming the command an event was relayed
+// from
+const MetaFrom = "from"
+
+// how long to wait before reconnecting to the broker
+const relayRetry = 10 * time.Second
+
+// Relay passes events between the default bus of this process and the other
+// commands through the broker
+type Relay struct {
+	socketPath string
+	name       string
+	retained   []string
+	out        *events.Subscription
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+	// failing to reach the broker, logged once until it works again
+	failing bool
+}
+
+// RelayEvents sends the events published in this process to the broker at
+// socketPath and publishes those of the other commands here, marked with
+// MetaFrom. name identifies this command. The latest events of the retained
+// topics are published right away, e.g. "sun" so a command started during
+// the night knows it's night. The broker doesn't have to be running yet, the
+// relay keeps reconnecting until closed.
+func RelayEvents(socketPath, name string, retained ...string) *Relay {
+	r := &Relay{
+		socketPath: socketPath,
+		name:       name,
+		retained:   retained,
+		out:        events.Subscribe("relay to broker", 0),
+	}
+	go r.send()
+	go r.receive()
+	return r
+}
+
+// Close stops relaying
+func (r *Relay) Close() {
+	r.mu.Lock()
+	r.closed = true
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mu.Unlock()
+	r.out.Close()
+}
+
+func (r *Relay) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// report logs the first failure and when it works again
+func (r *Relay) report(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err != nil && !r.failing && !r.closed:
+		log.Printf("event relay to %s failed, retrying:%v\n", r.socketPath, err)
+	case err == nil && r.failing:
+		log.Printf("event relay to %s working again\n", r.socketPath)
+	}
+	r.failing = err != nil
+}
+
+// send passes on the events published here, leaving out those which came
+// from other commands
+func (r *Relay) send() {
+	for e := range r.out.Events() {
+		if e.Meta[MetaFrom] != "" {
+			continue
+		}
+		r.report(r.publish(e.With(MetaFrom, r.name)))
+	}
+}
+
+func (r *Relay) publish(e events.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", r.socketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := json.NewEncoder(conn).Encode(Request{Publish: &e}); err != nil {
+		return err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// receive publishes the events of the other commands here, reconnecting
+// whenever the broker goes away
+func (r *Relay) receive() {
+	for !r.isClosed() {
+		err := r.subscribe()
+		r.report(err)
+		if r.isClosed() {
+			return
+		}
+		time.Sleep(relayRetry)
+	}
+}
+
+func (r *Relay) subscribe() error {
+	conn, err := net.Dial("unix", r.socketPath)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	r.conn = conn
+	r.mu.Unlock()
+	defer conn.Close()
+
+	req := Request{Subscribe: &Subscribe{Name: r.name, Retained: r.retained}}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+	r.report(nil)
+	dec := json.NewDecoder(conn)
+	for {
+		var e events.Event
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		// our own events come back too
+		if from := e.Meta[MetaFrom]; from == "" || from == r.name {
+			continue
+		}
+		events.Publish(e)
+	}
+}
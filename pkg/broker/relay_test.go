@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+)
+
+// serve starts a broker without sensors on a socket in a temporary directory
+func serve(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "broker.sock")
+	s := NewServer()
+	go s.Serve(path)
+	for i := 0; ; i++ {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			break
+		}
+		if i == 100 {
+			t.Fatal("broker not listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return path, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// subscribe streams events from the broker like another command would
+func subscribe(t *testing.T, path string, req Subscribe) (<-chan events.Event, func()) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(conn).Encode(Request{Subscribe: &req}); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan events.Event, 10)
+	go func() {
+		defer close(ch)
+		dec := json.NewDecoder(conn)
+		for {
+			var e events.Event
+			if dec.Decode(&e) != nil {
+				return
+			}
+			ch <- e
+		}
+	}()
+	// give the broker time to subscribe before anything is published
+	time.Sleep(50 * time.Millisecond)
+	return ch, func() { conn.Close() }
+}
+
+// publish sends e to the broker like another command would
+func publish(t *testing.T, path string, e events.Event) {
+	t.Helper()
+	r := &Relay{socketPath: path}
+	if err := r.publish(e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func next(t *testing.T, ch <-chan events.Event) events.Event {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return events.Event{}
+}
+
+func TestBrokerEvents(t *testing.T) {
+	path, stop := serve(t)
+	defer stop()
+
+	sun := events.New("sun", events.Sun, events.Day, events.Night).With(MetaFrom, "auto_light")
+	publish(t, path, sun)
+
+	doors, closeDoors := subscribe(t, path, Subscribe{Name: "doors", Topics: []string{string(events.Contact)}})
+	defer closeDoors()
+	all, closeAll := subscribe(t, path, Subscribe{Name: "all", Retained: []string{string(events.Sun)}})
+	defer closeAll()
+
+	// the latest sun event is sent to those asking for it
+	if e := next(t, all); e.Topic() != sun.Topic() || e.New != events.Night || e.Meta[MetaFrom] != "auto_light" {
+		t.Errorf("retained event %v", e)
+	}
+
+	door := events.New("158d0002676aec", events.Contact, events.Closed, events.Open).With("door", "rear door")
+	publish(t, path, door)
+	publish(t, path, events.New("led", events.Color, "#000000", "#ff8000"))
+	for _, ch := range []<-chan events.Event{doors, all} {
+		if e := next(t, ch); e.Topic() != door.Topic() || e.Old != events.Closed || e.New != events.Open ||
+			e.Meta["door"] != "rear door" || !e.Time.Equal(door.Time) {
+			t.Errorf("got %v, want %v", e, door)
+		}
+	}
+	if e := next(t, all); e.Kind != events.Color {
+		t.Errorf("got %v, want the LED color", e)
+	}
+	select {
+	case e := <-doors:
+		t.Errorf("contact subscriber got %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRelayEvents(t *testing.T) {
+	path, stop := serve(t)
+	defer stop()
+	others, closeOthers := subscribe(t, path, Subscribe{Name: "door_monitor"})
+	defer closeOthers()
+	publish(t, path, events.New("sun", events.Sun, "", events.Day).With(MetaFrom, "auto_light"))
+
+	local := events.Subscribe("test", 0)
+	defer local.Close()
+	r := RelayEvents(path, "auto_led", string(events.Sun))
+	defer r.Close()
+
+	// the retained sun event is published here
+	if e := next(t, local.Events()); e.Kind != events.Sun || e.Meta[MetaFrom] != "auto_light" {
+		t.Fatalf("got %v, want the retained sun event", e)
+	}
+	if e := next(t, others); e.Kind != events.Sun {
+		t.Fatalf("got %v, want the sun event", e)
+	}
+
+	// events from here go to the others, marked as ours
+	events.Publish(events.New("led", events.Color, "", "#ff8000"))
+	if e := next(t, local.Events()); e.Kind != events.Color {
+		t.Fatalf("got %v locally", e)
+	}
+	if e := next(t, others); e.Kind != events.Color || e.Meta[MetaFrom] != "auto_led" {
+		t.Errorf("broker got %v", e)
+	}
+
+	// events of the others are published here, ours don't come back
+	publish(t, path, events.New("158d0002676aec", events.Contact, events.Closed, events.Open).With(MetaFrom, "door_monitor"))
+	if e := next(t, local.Events()); e.Kind != events.Contact || e.Meta[MetaFrom] != "door_monitor" {
+		t.Errorf("got %v, want the door event", e)
+	}
+	next(t, others)
+	select {
+	case e := <-local.Events():
+		t.Errorf("also got %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
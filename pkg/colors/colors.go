@@ -48,12 +48,17 @@ func (c Color) mul(s float32) Color {
 // TemperatureToColor gets a temperature and returns a Color which represents this air temperature
 // ref: https://github.com/lilspikey/arduino_sketches/blob/master/nightlight/nightlight.h
 func TemperatureToColor(t float32) Color {
-	if t < minTemp {
+	return RangeToColor(float64(t), minTemp, maxTemp)
+}
+
+// RangeToColor maps v between min (purple/blue) and max (red) to a Color
+func RangeToColor(v, min, max float64) Color {
+	if v < min {
 		return definedColors[0]
-	} else if t > maxTemp {
+	} else if v > max {
 		return definedColors[numColor-1]
 	}
-	col := float64(t-minTemp) / (maxTemp - minTemp) * float64(numColor-1)
+	col := (v - min) / (max - min) * float64(numColor-1)
 	colLow := int(math.Floor(col))
 	colHigh := int(math.Ceil(col))
 	dx := float64(colHigh) - col
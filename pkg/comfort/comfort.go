@@ -0,0 +1,121 @@
+package comfort
+
+import (
+	"math"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+// Zone is a rough classification of how comfortable the air is
+type Zone string
+
+// comfort zones
+const (
+	Comfortable Zone = "comfortable"
+	Cold        Zone = "cold"
+	Hot         Zone = "hot"
+	Dry         Zone = "dry"
+	Humid       Zone = "humid"
+)
+
+// limits of the comfort zone
+const (
+	minTemp     = 18.0
+	maxTemp     = 26.0
+	minHumidity = 30.0
+	maxHumidity = 60.0
+)
+
+// Magnus formula coefficients, good between -45°C and 60°C
+const (
+	magnusB = 17.62
+	magnusC = 243.12
+)
+
+// DewPoint returns the dew point in °C from temperature in °C and relative
+// humidity in %, NaN if humidity isn't positive
+// ref: https://en.wikipedia.org/wiki/Dew_point#Calculating_the_dew_point
+func DewPoint(t, rh float64) float64 {
+	gamma := math.Log(rh/100) + magnusB*t/(magnusC+t)
+	return magnusC * gamma / (magnusB - gamma)
+}
+
+// HeatIndex returns the apparent temperature in °C from temperature in °C and relative humidity in %
+// ref: https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
+func HeatIndex(t, rh float64) float64 {
+	f := t*9/5 + 32
+	// simple formula first, which is good enough below 80°F
+	hi := 0.5 * (f + 61.0 + (f-68.0)*1.2 + rh*0.094)
+	if (hi+f)/2 >= 80 {
+		hi = -42.379 + 2.04901523*f + 10.14333127*rh -
+			0.22475541*f*rh - 0.00683783*f*f - 0.05481717*rh*rh +
+			0.00122874*f*f*rh + 0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+		if rh < 13 && f >= 80 && f <= 112 {
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(f-95))/17)
+		} else if rh > 85 && f >= 80 && f <= 87 {
+			hi += (rh - 85) / 10 * (87 - f) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
+}
+
+// AbsoluteHumidity returns water vapour density in g/m³ from temperature in °C and relative humidity in %
+func AbsoluteHumidity(t, rh float64) float64 {
+	// saturation vapour pressure in hPa times relative humidity
+	e := 6.112 * math.Exp(magnusB*t/(magnusC+t)) * rh / 100
+	return 216.7 * e / (273.15 + t)
+}
+
+// Classify returns the comfort zone for temperature in °C and relative humidity in %
+func Classify(t, rh float64) Zone {
+	switch {
+	case t < minTemp:
+		return Cold
+	case t > maxTemp:
+		return Hot
+	case rh < minHumidity:
+		return Dry
+	case rh > maxHumidity:
+		return Humid
+	}
+	return Comfortable
+}
+
+// Derive returns dew point, heat index and absolute humidity computed from
+// the temperature and humidity in readings, or nil if either is missing or
+// humidity is 0
+func Derive(readings sensors.Readings) sensors.Readings {
+	t, err := readings.Value(sensors.Temperature)
+	if err != nil {
+		return nil
+	}
+	rh, err := readings.Value(sensors.Humidity)
+	// the dew point of perfectly dry air is undefined (NaN)
+	if err != nil || rh <= 0 {
+		return nil
+	}
+	r, _ := readings.Get(sensors.Temperature)
+	derived := sensors.Readings{
+		{Quantity: sensors.DewPoint, Value: DewPoint(t, rh)},
+		{Quantity: sensors.HeatIndex, Value: HeatIndex(t, rh)},
+		{Quantity: sensors.AbsoluteHumidity, Value: AbsoluteHumidity(t, rh)},
+	}
+	for i := range derived {
+		derived[i].Sensor, derived[i].Time = r.Sensor, r.Time
+		derived[i].Raw = derived[i].Value
+	}
+	return derived
+}
+
+// ZoneOf returns the comfort zone for the temperature and humidity in readings
+func ZoneOf(readings sensors.Readings) (Zone, error) {
+	t, err := readings.Value(sensors.Temperature)
+	if err != nil {
+		return "", err
+	}
+	rh, err := readings.Value(sensors.Humidity)
+	if err != nil {
+		return "", err
+	}
+	return Classify(t, rh), nil
+}
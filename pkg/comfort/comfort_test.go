@@ -0,0 +1,133 @@
+package comfort
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+func fahrenheit(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+func TestDewPoint(t *testing.T) {
+	// reference values of the Magnus formula over water
+	tests := []struct {
+		t, rh, want float64
+	}{
+		{25, 60, 16.7},
+		{20, 50, 9.3},
+		{30, 80, 26.2},
+		{10, 90, 8.4},
+		{-10, 70, -14.4},
+		{22, 100, 22},
+	}
+	for _, tt := range tests {
+		if got := DewPoint(tt.t, tt.rh); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("DewPoint(%v, %v) = %.2f, want %v", tt.t, tt.rh, got, tt.want)
+		}
+	}
+	if got := DewPoint(20, 0); !math.IsNaN(got) {
+		t.Errorf("DewPoint(20, 0) = %v, want NaN", got)
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	// NWS heat index chart, in °F
+	tests := []struct {
+		f, rh, want float64
+	}{
+		{70, 50, 69}, // simple formula
+		{80, 40, 80},
+		{90, 60, 100},
+		{86, 85, 102},
+		{96, 65, 121},
+		{104, 55, 137},
+	}
+	for _, tt := range tests {
+		got := HeatIndex(fahrenheit(tt.f), tt.rh)
+		if want := fahrenheit(tt.want); math.Abs(got-want) > 0.5 {
+			t.Errorf("HeatIndex(%v°F, %v) = %.1f°C, want %.1f°C", tt.f, tt.rh, got, want)
+		}
+	}
+}
+
+func TestAbsoluteHumidity(t *testing.T) {
+	// water vapour density tables, in g/m³
+	tests := []struct {
+		t, rh, want float64
+	}{
+		{0, 100, 4.85},
+		{20, 100, 17.3},
+		{25, 50, 11.5},
+		{30, 100, 30.4},
+		{20, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := AbsoluteHumidity(tt.t, tt.rh); math.Abs(got-tt.want) > 0.2 {
+			t.Errorf("AbsoluteHumidity(%v, %v) = %.2f, want %v", tt.t, tt.rh, got, tt.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		t, rh float64
+		want  Zone
+	}{
+		{22, 45, Comfortable},
+		{18, 30, Comfortable},
+		{26, 60, Comfortable},
+		{17.9, 45, Cold},
+		{26.1, 45, Hot},
+		{22, 29, Dry},
+		{22, 61, Humid},
+		// temperature first
+		{15, 80, Cold},
+		{30, 20, Hot},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.t, tt.rh); got != tt.want {
+			t.Errorf("Classify(%v, %v) = %s, want %s", tt.t, tt.rh, got, tt.want)
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	now := time.Now()
+	reading := func(q sensors.Quantity, v float64) sensors.Reading {
+		return sensors.Reading{Sensor: "dht22", Quantity: q, Value: v, Raw: v, Time: now}
+	}
+	temp := reading(sensors.Temperature, 25)
+
+	derived := Derive(sensors.Readings{temp, reading(sensors.Humidity, 60)})
+	if len(derived) != 3 {
+		t.Fatalf("Derive() = %v", derived)
+	}
+	for q, want := range map[sensors.Quantity]float64{
+		sensors.DewPoint:         16.7,
+		sensors.HeatIndex:        25.1, // simple formula below 80°F
+		sensors.AbsoluteHumidity: 13.8,
+	} {
+		r, ok := derived.Get(q)
+		if !ok || math.Abs(r.Value-want) > 0.1 || r.Sensor != "dht22" || !r.Time.Equal(now) {
+			t.Errorf("derived %s = %+v, want %v", q, r, want)
+		}
+	}
+
+	rejected := reading(sensors.Humidity, 60)
+	rejected.Rejected = true
+	for name, readings := range map[string]sensors.Readings{
+		"no humidity":       {temp},
+		"no temperature":    {reading(sensors.Humidity, 60)},
+		"rejected humidity": {temp, rejected},
+		"dry":               {temp, reading(sensors.Humidity, 0)},
+		"negative humidity": {temp, reading(sensors.Humidity, -1)},
+	} {
+		if got := Derive(readings); got != nil {
+			t.Errorf("%s:Derive() = %v, want nil", name, got)
+		}
+	}
+}
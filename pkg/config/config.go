@@ -0,0 +1,580 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/starryalley/smart_home/pkg/broker"
+	"github.com/starryalley/smart_home/pkg/hardware"
+	"github.com/starryalley/smart_home/pkg/miio"
+	"github.com/starryalley/smart_home/pkg/notify"
+	"github.com/starryalley/smart_home/pkg/sensors"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+// DefaultPath is where commands look for the config file. If it doesn't
+// exist the built-in defaults are used.
+const DefaultPath = "/etc/smart_home/config.yaml"
+
+// environment variables overriding secrets in the config file
+const (
+	EnvWAQIToken    = "SMART_HOME_WAQI_TOKEN"
+	EnvIFTTTKey     = "SMART_HOME_IFTTT_KEY"
+	EnvGatewayToken = "SMART_HOME_GATEWAY_TOKEN"
+	// followed by the notifier name and _TOKEN, _KEY or _PASSWORD, see
+	// NotifierEnv
+	EnvNotifierPrefix = "SMART_HOME_NOTIFIER_"
+)
+
+// NotifierEnv returns the environment variable overriding a secret (token,
+// key or password) of the named notifier, e.g. SMART_HOME_NOTIFIER_PHONE_TOKEN.
+// Characters other than letters and digits in the name become underscores.
+func NotifierEnv(name, secret string) string {
+	env := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name+"_"+secret)
+	return EnvNotifierPrefix + env
+}
+
+// Config is the configuration shared by all commands, with one section per command
+type Config struct {
+	Location    Location            `yaml:"location"`
+	Hardware    *hardware.Config    `yaml:"hardware" reload:"restart"`
+	Calibration sensors.Calibration `yaml:"calibration" reload:"restart"`
+	// outlier rejection and smoothing per sensor name
+	Filters sensors.Filters `yaml:"filter" reload:"restart"`
+	// unix socket of the sensor broker, read sensors directly if empty
+	BrokerSocket string  `yaml:"broker_socket" reload:"restart"`
+	Gateway      Gateway `yaml:"gateway" reload:"restart"`
+	// gateway sub-devices, referred to by name in the sections below
+	Devices xiaomi.Registry `yaml:"devices"`
+	// notification backends by name, and which of them each event is sent
+	// to. Events not listed go to "default".
+	Notifiers map[string]notify.Spec `yaml:"notifiers" reload:"secret"`
+	Notify    map[string][]string    `yaml:"notify"`
+	// minimum time between notifications with the same event and title
+	RateLimits map[string]time.Duration `yaml:"rate_limits"`
+
+	AutoLED      AutoLED      `yaml:"auto_led"`
+	AutoLight    AutoLight    `yaml:"auto_light"`
+	DoorMonitor  DoorMonitor  `yaml:"door_monitor"`
+	SensorLogger SensorLogger `yaml:"sensor_logger"`
+	SensorBroker SensorBroker `yaml:"sensor_broker" reload:"restart"`
+}
+
+// Location is where the house is, for sunrise/sunset and air quality
+type Location struct {
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+}
+
+// Gateway is the Xiaomi gateway. If Address is empty the Node.js miio CLI is
+// used instead of talking to it directly.
+type Gateway struct {
+	Address string `yaml:"address"`
+	// 32 character hex token, as shown by `miio discover`
+	Token string `yaml:"token" reload:"secret"`
+	// receive reports and heartbeats over multicast, needs the LAN protocol
+	// enabled in the Mi Home app. Interface is the network interface to
+	// listen on, the system default if empty.
+	Listen    bool   `yaml:"listen"`
+	Interface string `yaml:"interface"`
+}
+
+// AutoLED configures auto_led
+type AutoLED struct {
+	UpdateInterval time.Duration `yaml:"update_interval" reload:"restart"`
+	AQIInterval    time.Duration `yaml:"aqi_interval" reload:"restart"`
+	// get your token here: https://aqicn.org/data-platform/token/#/
+	WAQIToken string `yaml:"waqi_token" reload:"secret"`
+	ColorBy   string `yaml:"color_by"`
+}
+
+// AutoLight configures auto_light
+type AutoLight struct {
+	CheckInterval time.Duration `yaml:"check_interval" reload:"restart"`
+	// where node and miio are installed
+	MiioBinPath string `yaml:"miio_bin_path" reload:"restart"`
+	// smart plug of the floor lamp: device name or ID
+	Plug string `yaml:"plug"`
+	// turn on the lamp at or below DarkLux, turn it off above BrightLux
+	DarkLux   float64 `yaml:"dark_lux"`
+	BrightLux float64 `yaml:"bright_lux"`
+	// a door opening at night, as told by door_monitor through the sensor
+	// broker, turns the lamp on for this long, disabled if 0
+	DoorLight time.Duration `yaml:"door_light"`
+}
+
+// DoorMonitor configures door_monitor
+type DoorMonitor struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	// how often to poll when gateway events are received over multicast,
+	// just in case one is missed
+	FallbackInterval time.Duration `yaml:"fallback_interval"`
+	// defaults for doors not setting their own
+	WarningTimeout time.Duration `yaml:"warning_timeout"`
+	Reminders      Reminders     `yaml:"reminders"`
+	Debounce       Debounce      `yaml:"debounce"`
+	Health         Health        `yaml:"health"`
+	MiioBinPath    string        `yaml:"miio_bin_path" reload:"restart"`
+	Doors          []Door        `yaml:"doors"`
+	Ack            Ack           `yaml:"ack"`
+	// where door states are kept across restarts, not kept if empty
+	StateFile string `yaml:"state_file" reload:"restart"`
+	// every opening and closing is appended to, for door_history, not kept
+	// if empty
+	HistoryFile string `yaml:"history_file" reload:"restart"`
+}
+
+// Ack is the web page linked from door notifications to snooze a door's
+// reminders, recording who did
+type Ack struct {
+	// address to listen on, e.g. ":8080", disabled if empty
+	Listen string `yaml:"listen" reload:"restart"`
+	// how the page is reached from our phones, e.g. http://raspberrypi.local:8080
+	URL string `yaml:"url"`
+	// signs the links so only those notified can snooze, required with
+	// Listen
+	Secret string `yaml:"secret" reload:"secret"`
+	// snooze durations offered
+	Snooze []time.Duration `yaml:"snooze"`
+}
+
+// Door is a door watched by door_monitor
+type Door struct {
+	// contact sensor: device name or ID
+	Device         string        `yaml:"device"`
+	WarningTimeout time.Duration `yaml:"warning_timeout"`
+	// notification sent when the door is left open, defaults to
+	// "<Name> Warning" and "<Name> left open for too long", named after the
+	// device
+	Title     string     `yaml:"title"`
+	Message   string     `yaml:"message"`
+	Reminders *Reminders `yaml:"reminders"`
+	Debounce  *Debounce  `yaml:"debounce"`
+}
+
+// Reminders is what happens after the first warning about a door left open
+type Reminders struct {
+	// repeat the warning this often while the door stays open, 0 for once
+	Every time.Duration `yaml:"every"`
+	// once the door has been open this long, send the reminders as
+	// EscalateEvent instead, e.g. routed to more notifiers
+	EscalateAfter time.Duration `yaml:"escalate_after"`
+	EscalateEvent string        `yaml:"escalate_event"`
+	// send a follow-up when a door warned about is closed
+	Closed bool `yaml:"closed"`
+}
+
+// Debounce is how contact readings are trusted. A change is taken once seen
+// in Readings readings in a row or once it held for Hold, whichever comes
+// first, right away if neither is set.
+type Debounce struct {
+	Readings int           `yaml:"readings"`
+	Hold     time.Duration `yaml:"hold"`
+	// a sensor changing FlapChanges times within FlapWindow is reported
+	// faulty and ignored until it settles, disabled if 0
+	FlapChanges int           `yaml:"flap_changes"`
+	FlapWindow  time.Duration `yaml:"flap_window"`
+}
+
+// Health is when to alert about door sensors
+type Health struct {
+	// a sensor not heard from for this long, by a successful read or a
+	// gateway report, is reported offline, disabled if 0
+	OfflineAfter time.Duration `yaml:"offline_after"`
+	// battery voltage in mV below which it's reported low, disabled if 0
+	LowBattery int `yaml:"low_battery"`
+	// how often battery voltages are read, they also come with gateway
+	// heartbeats
+	BatteryInterval time.Duration `yaml:"battery_interval"`
+}
+
+// SensorLogger configures sensor_logger
+type SensorLogger struct {
+	UpdateInterval time.Duration `yaml:"update_interval" reload:"restart"`
+	MaxRetry       int           `yaml:"max_retry"`
+	// google sheet credential json file
+	Credentials   string `yaml:"credentials" reload:"restart"`
+	SpreadsheetID string `yaml:"spreadsheet_id"`
+	Sheet         string `yaml:"sheet"`
+}
+
+// SensorBroker configures sensor_broker
+type SensorBroker struct {
+	Socket string `yaml:"socket"`
+	// DHT22 is slow, it's polled less often than other sensors
+	DHTInterval time.Duration `yaml:"dht_interval"`
+	Interval    time.Duration `yaml:"interval"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		// Ringwood, VIC, Australia
+		Location:    Location{Latitude: -37.8114, Longitude: 145.2306},
+		Hardware:    hardware.Default(),
+		Calibration: sensors.Calibration{},
+		Filters:     sensors.Filters{},
+		Devices: xiaomi.Registry{
+			{Name: "floor lamp", ID: "158d0002498b8e", Model: "plug"},
+			{Name: "rear door", ID: "158d0002676aec", Model: "magnet"},
+		},
+		AutoLED: AutoLED{
+			UpdateInterval: time.Minute,
+			AQIInterval:    time.Hour,
+			ColorBy:        string(sensors.Temperature),
+		},
+		AutoLight: AutoLight{
+			CheckInterval: 10 * time.Second,
+			MiioBinPath:   "/usr/local/lib/nodejs/bin/",
+			Plug:          "floor lamp",
+			DarkLux:       15,
+			BrightLux:     120,
+		},
+		DoorMonitor: DoorMonitor{
+			CheckInterval:    30 * time.Second,
+			FallbackInterval: 5 * time.Minute,
+			WarningTimeout:   2 * time.Minute,
+			Reminders:        Reminders{Every: 10 * time.Minute, Closed: true},
+			Debounce:         Debounce{Hold: 3 * time.Second, FlapChanges: 6, FlapWindow: 2 * time.Minute},
+			Health:           Health{OfflineAfter: 30 * time.Minute, LowBattery: 2800, BatteryInterval: 6 * time.Hour},
+			Ack:              Ack{Snooze: []time.Duration{30 * time.Minute, time.Hour, 4 * time.Hour}},
+			MiioBinPath:      "/usr/local/bin/",
+			StateFile:        "/var/lib/smart_home/door_monitor.json",
+			HistoryFile:      "/var/lib/smart_home/door_history.jsonl",
+			Doors: []Door{
+				{Device: "rear door", Title: "Rear Door Warning", Message: "Door left open for too long"},
+			},
+		},
+		SensorLogger: SensorLogger{
+			UpdateInterval: 10 * time.Minute,
+			MaxRetry:       3,
+			Credentials:    "/home/starryalley/.secret/google_sheet_credentials.json",
+			SpreadsheetID:  "15Zyy0_swv2YazuL9UdZ4YYkPfaIwTpPNtPHLAlsLtcY",
+			Sheet:          "RawData",
+		},
+		SensorBroker: SensorBroker{
+			Socket:      broker.DefaultSocket,
+			DHTInterval: 30 * time.Second,
+			Interval:    5 * time.Second,
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults, applies
+// environment overrides and validates the common sections. A missing file
+// at DefaultPath isn't an error.
+func Load(path string) (*Config, error) {
+	c := Default()
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !(os.IsNotExist(err) && path == DefaultPath) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, fmt.Errorf("invalid config file %s:%v", path, err)
+		}
+	}
+	if v := os.Getenv(EnvWAQIToken); v != "" {
+		c.AutoLED.WAQIToken = v
+	}
+	if v := os.Getenv(EnvIFTTTKey); v != "" {
+		for name, spec := range c.Notifiers {
+			if spec.Type == notify.TypeIFTTT && spec.Key == "" {
+				spec.Key = v
+				c.Notifiers[name] = spec
+			}
+		}
+	}
+	for name, spec := range c.Notifiers {
+		for secret, field := range map[string]*string{"token": &spec.Token, "key": &spec.Key, "password": &spec.Password} {
+			if v := os.Getenv(NotifierEnv(name, secret)); v != "" {
+				*field = v
+			}
+		}
+		c.Notifiers[name] = spec
+	}
+	if v := os.Getenv(EnvGatewayToken); v != "" {
+		c.Gateway.Token = v
+	}
+	if c.Hardware == nil {
+		c.Hardware = hardware.Default()
+	}
+	for i := range c.Hardware.Sensors {
+		c.Hardware.Sensors[i] = c.Hardware.Sensors[i].WithDefaults()
+	}
+	return c, c.Validate()
+}
+
+// Validate checks the sections shared by all commands
+func (c *Config) Validate() error {
+	if c.Location.Latitude < -90 || c.Location.Latitude > 90 ||
+		c.Location.Longitude < -180 || c.Location.Longitude > 180 {
+		return fmt.Errorf("invalid location:%v,%v", c.Location.Latitude, c.Location.Longitude)
+	}
+	if c.Gateway.Address != "" {
+		if _, err := miio.ParseToken(c.Gateway.Token); err != nil {
+			return fmt.Errorf("gateway:%v (token can be set with %s)", err, EnvGatewayToken)
+		}
+	}
+	if err := c.Devices.Validate(); err != nil {
+		return err
+	}
+	n := c.Notifications()
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	for name, f := range c.Filters {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("filter %s:%v", name, err)
+		}
+	}
+	return c.Hardware.Validate()
+}
+
+// Device looks up a gateway sub-device by name or ID and checks it can do
+// capability
+func (c *Config) Device(ref string, capability xiaomi.Capability) (xiaomi.Device, error) {
+	d, err := c.Devices.Lookup(ref)
+	if err != nil {
+		return d, err
+	}
+	return d, d.Check(capability)
+}
+
+// Door returns the door_monitor settings of the door with the given device,
+// defaults filled in and named after the device in the registry
+func (c *Config) Door(device string) (Door, bool) {
+	m := &c.DoorMonitor
+	for _, d := range m.Doors {
+		if d.Device != device {
+			continue
+		}
+		name := d.Device
+		if dev, err := c.Devices.Lookup(d.Device); err == nil {
+			name = dev.Name
+		}
+		if d.WarningTimeout == 0 {
+			d.WarningTimeout = m.WarningTimeout
+		}
+		if d.Title == "" {
+			d.Title = strings.Title(name) + " Warning"
+		}
+		if d.Message == "" {
+			d.Message = strings.Title(name) + " left open for too long"
+		}
+		if d.Reminders == nil {
+			d.Reminders = &m.Reminders
+		}
+		if d.Debounce == nil {
+			d.Debounce = &m.Debounce
+		}
+		return d, true
+	}
+	return Door{}, false
+}
+
+// readings from the broker older than this many polls are rejected
+const brokerPolls = 4
+
+// BrokerClient returns a client reading the sensor from the broker, rejecting
+// readings older than a few of the broker's polls
+func (c *Config) BrokerClient(spec sensors.Spec) *broker.Client {
+	client := broker.NewClient(c.BrokerSocket, spec.Name)
+	interval := c.SensorBroker.Interval
+	if spec.Kind == sensors.KindDHT22 {
+		interval = c.SensorBroker.DHTInterval
+	}
+	client.MaxAge = brokerPolls * interval
+	return client
+}
+
+// Notifications returns the notifier settings, for a notify.Router
+func (c *Config) Notifications() notify.Config {
+	return notify.Config{
+		Notifiers:  c.Notifiers,
+		Routes:     c.Notify,
+		RateLimits: c.RateLimits,
+	}
+}
+
+// Validate checks the auto_led section
+func (c *AutoLED) Validate() error {
+	if c.UpdateInterval <= 0 || c.AQIInterval <= 0 {
+		return errors.New("auto_led:intervals must be positive")
+	}
+	return nil
+}
+
+// Validate checks the auto_light section
+func (c *AutoLight) Validate() error {
+	switch {
+	case c.CheckInterval <= 0:
+		return errors.New("auto_light:check_interval must be positive")
+	case c.Plug == "":
+		return errors.New("auto_light:plug is required")
+	case c.DarkLux >= c.BrightLux:
+		return fmt.Errorf("auto_light:dark_lux %v must be below bright_lux %v", c.DarkLux, c.BrightLux)
+	case c.DoorLight < 0:
+		return errors.New("auto_light:door_light can't be negative")
+	}
+	return nil
+}
+
+// Validate checks the door_monitor section
+func (c *DoorMonitor) Validate() error {
+	switch {
+	case c.CheckInterval <= 0 || c.FallbackInterval <= 0 || c.WarningTimeout <= 0:
+		return errors.New("door_monitor:check_interval, fallback_interval and warning_timeout must be positive")
+	case len(c.Doors) == 0:
+		return errors.New("door_monitor:no doors")
+	}
+	if err := c.Reminders.Validate(); err != nil {
+		return fmt.Errorf("door_monitor:%v", err)
+	}
+	if err := c.Debounce.Validate(); err != nil {
+		return fmt.Errorf("door_monitor:%v", err)
+	}
+	switch {
+	case c.Health.OfflineAfter < 0 || c.Health.LowBattery < 0:
+		return errors.New("door_monitor:health offline_after and low_battery can't be negative")
+	case c.Health.LowBattery > 0 && c.Health.BatteryInterval <= 0:
+		return errors.New("door_monitor:health battery_interval must be positive with low_battery")
+	}
+	if c.Ack.Listen != "" && c.Ack.URL == "" {
+		return errors.New("door_monitor:ack url is required with listen")
+	}
+	if c.Ack.Listen != "" && c.Ack.Secret == "" {
+		return errors.New("door_monitor:ack secret is required with listen")
+	}
+	for _, d := range c.Ack.Snooze {
+		if d <= 0 {
+			return errors.New("door_monitor:ack snooze durations must be positive")
+		}
+	}
+	seen := make(map[string]bool)
+	for _, d := range c.Doors {
+		switch {
+		case d.Device == "":
+			return errors.New("door_monitor:device is required for every door")
+		case seen[d.Device]:
+			return fmt.Errorf("door_monitor:door %q listed twice", d.Device)
+		case d.WarningTimeout < 0:
+			return fmt.Errorf("door_monitor:door %q:warning_timeout must not be negative", d.Device)
+		case d.Reminders != nil && d.Reminders.Validate() != nil:
+			return fmt.Errorf("door_monitor:door %q:%v", d.Device, d.Reminders.Validate())
+		case d.Debounce != nil && d.Debounce.Validate() != nil:
+			return fmt.Errorf("door_monitor:door %q:%v", d.Device, d.Debounce.Validate())
+		}
+		seen[d.Device] = true
+	}
+	return nil
+}
+
+// Validate checks the reminder schedule
+func (c *Reminders) Validate() error {
+	switch {
+	case c.Every < 0 || c.EscalateAfter < 0:
+		return errors.New("reminders:every and escalate_after can't be negative")
+	case c.EscalateAfter > 0 && c.EscalateEvent == "":
+		return errors.New("reminders:escalate_event is required with escalate_after")
+	}
+	return nil
+}
+
+// Validate checks the debounce settings
+func (c *Debounce) Validate() error {
+	switch {
+	case c.Readings < 0 || c.Hold < 0:
+		return errors.New("debounce:readings and hold can't be negative")
+	case c.FlapChanges < 0:
+		return errors.New("debounce:flap_changes can't be negative")
+	case c.FlapChanges > 0 && c.FlapWindow <= 0:
+		return errors.New("debounce:flap_window must be positive with flap_changes")
+	}
+	return nil
+}
+
+// Validate checks the sensor_logger section
+func (c *SensorLogger) Validate() error {
+	switch {
+	case c.UpdateInterval <= 0:
+		return errors.New("sensor_logger:update_interval must be positive")
+	case c.MaxRetry < 1:
+		return errors.New("sensor_logger:max_retry must be at least 1")
+	case c.Credentials == "" || c.SpreadsheetID == "" || c.Sheet == "":
+		return errors.New("sensor_logger:credentials, spreadsheet_id and sheet are required")
+	}
+	return nil
+}
+
+// Validate checks the sensor_broker section
+func (c *SensorBroker) Validate() error {
+	switch {
+	case c.Socket == "":
+		return errors.New("sensor_broker:socket is required")
+	case c.DHTInterval <= 0 || c.Interval <= 0:
+		return errors.New("sensor_broker:intervals must be positive")
+	}
+	return nil
+}
+
+// Flags are command line flags overriding the config file
+type Flags struct {
+	path     *string
+	broker   *string
+	hardware *hardware.Flags
+}
+
+// RegisterFlags adds -config to fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		path: fs.String("config", DefaultPath, "YAML config file"),
+	}
+}
+
+// RegisterHardwareFlags adds -config and the hardware overrides to fs
+func RegisterHardwareFlags(fs *flag.FlagSet) *Flags {
+	f := RegisterFlags(fs)
+	f.hardware = hardware.RegisterFlags(fs)
+	return f
+}
+
+// RegisterSensorFlags adds -config, -broker and the hardware overrides to fs,
+// for commands reading sensors
+func RegisterSensorFlags(fs *flag.FlagSet) *Flags {
+	f := RegisterHardwareFlags(fs)
+	f.broker = fs.String("broker", "", "read sensors from the sensor broker listening on this unix socket")
+	return f
+}
+
+// Load loads the config file and applies the flag overrides
+func (f *Flags) Load() (*Config, error) {
+	c, err := Load(*f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.broker != nil && *f.broker != "" {
+		c.BrokerSocket = *f.broker
+	}
+	if f.hardware != nil {
+		if err := f.hardware.Apply(c.Hardware); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+	"github.com/starryalley/smart_home/pkg/xiaomi"
+)
+
+func TestNotifierEnv(t *testing.T) {
+	tests := []struct {
+		name, secret, want string
+	}{
+		{"phone", "token", "SMART_HOME_NOTIFIER_PHONE_TOKEN"},
+		{"mail", "password", "SMART_HOME_NOTIFIER_MAIL_PASSWORD"},
+		{"my-phone 2", "key", "SMART_HOME_NOTIFIER_MY_PHONE_2_KEY"},
+	}
+	for _, tt := range tests {
+		if got := NotifierEnv(tt.name, tt.secret); got != tt.want {
+			t.Errorf("NotifierEnv(%q, %q) = %q, want %q", tt.name, tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestLoadNotifierSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+notifiers:
+  bot: {type: telegram, chat_id: "42"}
+  mail: {type: smtp, host: smtp.example.com, username: pi, password: in-file, from: pi@example.com, to: [me@example.com]}
+  ifttt: {type: ifttt}
+notify:
+  default: [bot, mail, ifttt]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"SMART_HOME_NOTIFIER_BOT_TOKEN":     "bot-token",
+		"SMART_HOME_NOTIFIER_MAIL_PASSWORD": "from-env",
+		EnvIFTTTKey:                         "ifttt-key",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Notifiers["bot"].Token; got != "bot-token" {
+		t.Errorf("telegram token = %q", got)
+	}
+	if got := c.Notifiers["mail"].Password; got != "from-env" {
+		t.Errorf("smtp password = %q", got)
+	}
+	if got := c.Notifiers["ifttt"].Key; got != "ifttt-key" {
+		t.Errorf("ifttt key = %q", got)
+	}
+}
+
+func TestLoadFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+filter:
+  dht22:
+    bounds: {temperature: {min: -20, max: 45}}
+    max_rate: {humidity: 1}
+    smoothing: ema
+    alpha: 0.25
+  tsl2561: {smoothing: median, window: 3}
+`)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dht := c.Filters["dht22"]
+	if dht.Bounds[sensors.Temperature] != (sensors.Bounds{Min: -20, Max: 45}) || dht.MaxRate[sensors.Humidity] != 1 ||
+		dht.Smoothing != sensors.SmoothEMA || dht.Alpha != 0.25 {
+		t.Errorf("dht22 filter = %+v", dht)
+	}
+	if tsl := c.Filters["tsl2561"]; tsl.Smoothing != sensors.SmoothMedian || tsl.Window != 3 {
+		t.Errorf("tsl2561 filter = %+v", tsl)
+	}
+
+	write("filter:\n  dht22: {smoothing: ema}\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "filter dht22:") {
+		t.Errorf("Load() with an invalid filter:%v", err)
+	}
+}
+
+func TestDoorMonitorValidateAck(t *testing.T) {
+	tests := []struct {
+		name string
+		ack  Ack
+		ok   bool
+	}{
+		{"disabled", Ack{}, true},
+		{"signed", Ack{Listen: ":8080", URL: "http://pi:8080", Secret: "s"}, true},
+		{"no url", Ack{Listen: ":8080", Secret: "s"}, false},
+		{"no secret", Ack{Listen: ":8080", URL: "http://pi:8080"}, false},
+		{"no snooze", Ack{Listen: ":8080", URL: "http://pi:8080", Secret: "s", Snooze: []time.Duration{0}}, false},
+	}
+	for _, tt := range tests {
+		c := Default().DoorMonitor
+		c.Ack = tt.ack
+		if err := c.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s:Validate() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestDoorDefaults(t *testing.T) {
+	c := Default()
+	c.Devices = xiaomi.Registry{{Name: "rear door", ID: "158d0002676aec", Model: "magnet"}}
+	c.DoorMonitor.Doors = []Door{
+		{Device: "158d0002676aec"},
+		{Device: "158d000283ae42", Title: "Front", Message: "Front open", WarningTimeout: time.Minute},
+	}
+	tests := []struct {
+		device, title, message string
+		timeout                time.Duration
+	}{
+		{"158d0002676aec", "Rear Door Warning", "Rear Door left open for too long", c.DoorMonitor.WarningTimeout},
+		{"158d000283ae42", "Front", "Front open", time.Minute},
+	}
+	for _, tt := range tests {
+		d, ok := c.Door(tt.device)
+		if !ok || d.Title != tt.title || d.Message != tt.message || d.WarningTimeout != tt.timeout {
+			t.Errorf("Door(%q) = %+v, %v", tt.device, d, ok)
+		}
+	}
+	if _, ok := c.Door("158d00027b6f38"); ok {
+		t.Error("Door() of a device not monitored")
+	}
+}
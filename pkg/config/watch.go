@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// PollInterval is how often a Watcher checks the config file for changes
+var PollInterval = 5 * time.Second
+
+// Watcher keeps the current config of a running command, reloading it when
+// the file changes or on SIGHUP. A config failing validation is logged and
+// the previous one kept.
+type Watcher struct {
+	flags   *Flags
+	check   func(*Config) error
+	current atomic.Value
+	modTime time.Time
+}
+
+// Watch loads the config, runs check (the command's own validation and
+// overrides, may be nil) and starts watching for changes
+func (f *Flags) Watch(check func(*Config) error) (*Watcher, error) {
+	w := &Watcher{flags: f, check: check}
+	w.modTime = w.stat()
+	c, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(c)
+	go w.run()
+	return w, nil
+}
+
+// Config returns the current config. It must not be modified.
+func (w *Watcher) Config() *Config {
+	return w.current.Load().(*Config)
+}
+
+func (w *Watcher) load() (*Config, error) {
+	c, err := w.flags.Load()
+	if err != nil {
+		return nil, err
+	}
+	if w.check != nil {
+		if err := w.check(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// modification time of the config file, zero if it doesn't exist
+func (w *Watcher) stat() time.Time {
+	fi, err := os.Stat(*w.flags.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+func (w *Watcher) run() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+			w.modTime = w.stat()
+			w.reload("SIGHUP")
+		case <-ticker.C:
+			if t := w.stat(); !t.Equal(w.modTime) {
+				w.modTime = t
+				w.reload("file changed")
+			}
+		}
+	}
+}
+
+func (w *Watcher) reload(reason string) {
+	c, err := w.load()
+	if err != nil {
+		log.Printf("config reload (%s) failed, keeping current config:%v\n", reason, err)
+		return
+	}
+	changes := Diff(w.Config(), c)
+	if len(changes) == 0 {
+		log.Printf("config reload (%s):no changes\n", reason)
+		return
+	}
+	w.current.Store(c)
+	log.Printf("config reload (%s):%s\n", reason, strings.Join(changes, ", "))
+}
+
+// Diff lists the settings changed between a and b as "key:old -> new". Secrets
+// aren't printed and settings only read at startup are marked.
+func Diff(a, b *Config) []string {
+	var changes []string
+	diff(reflect.ValueOf(*a), reflect.ValueOf(*b), "", "", &changes)
+	return changes
+}
+
+func diff(a, b reflect.Value, key, tag string, changes *[]string) {
+	if a.Kind() == reflect.Ptr && !a.IsNil() && !b.IsNil() {
+		a, b = a.Elem(), b.Elem()
+	}
+	switch {
+	case a.Kind() == reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			diff(a.Field(i), b.Field(i), fieldKey(key, f), fieldTag(f, tag), changes)
+		}
+		return
+	// slices of the same length are compared element by element, e.g.
+	// door_monitor.doors[1].warning_timeout
+	case a.Kind() == reflect.Slice && a.Len() == b.Len():
+		for i := 0; i < a.Len(); i++ {
+			diff(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", key, i), tag, changes)
+		}
+		return
+	}
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	change := fmt.Sprintf("%s:%s -> %s", key, format(a), format(b))
+	switch tag {
+	case "secret":
+		change = key + ":changed"
+	case "restart":
+		change += " (needs restart)"
+	}
+	*changes = append(*changes, change)
+}
+
+func fieldKey(key string, f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if key != "" {
+		name = key + "." + name
+	}
+	return name
+}
+
+// reload tag of a field, inherited from the enclosing one if not set
+func fieldTag(f reflect.StructField, tag string) string {
+	if t := f.Tag.Get("reload"); t != "" {
+		return t
+	}
+	return tag
+}
+
+// format prints a setting the way it's written in the file, following
+// pointers, leaving out unset fields and hiding secrets
+func format(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "none"
+		}
+		return format(v.Elem())
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" || isZero(v.Field(i)) {
+				continue
+			}
+			value := format(v.Field(i))
+			if fieldTag(f, "") == "secret" {
+				value = "***"
+			}
+			fields = append(fields, fieldKey("", f)+":"+value)
+		}
+		return "{" + strings.Join(fields, " ") + "}"
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = format(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value)
+		for _, k := range v.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			keys = append(keys, name)
+			values[name] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			items[i] = k + ":" + format(values[k])
+		}
+		return "{" + strings.Join(items, " ") + "}"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
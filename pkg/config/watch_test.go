@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "no change",
+			change: func(c *Config) {},
+		},
+		{
+			name:   "plain setting",
+			change: func(c *Config) { c.AutoLight.DarkLux = 20 },
+			want:   []string{"auto_light.dark_lux:15 -> 20"},
+		},
+		{
+			name:   "needs restart",
+			change: func(c *Config) { c.AutoLight.CheckInterval = time.Minute },
+			want:   []string{"auto_light.check_interval:10s -> 1m0s (needs restart)"},
+		},
+		{
+			name:   "secret",
+			change: func(c *Config) { c.AutoLED.WAQIToken = "0123456789abcdef" },
+			want:   []string{"auto_led.waqi_token:changed"},
+		},
+		{
+			name:   "slice element behind a pointer",
+			change: func(c *Config) { c.Hardware.Sensors[0].Pin = 17 },
+			want:   []string{"hardware.sensors[0].pin:4 -> 17 (needs restart)"},
+		},
+		{
+			name:   "slice length",
+			change: func(c *Config) { c.Hardware.Sensors = c.Hardware.Sensors[:1] },
+			want: []string{"hardware.sensors:[{name:dht22 kind:dht22 pin:4}, {name:tsl2561 kind:tsl2561 address:57}] -> " +
+				"[{name:dht22 kind:dht22 pin:4}] (needs restart)"},
+		},
+		{
+			name: "struct in a slice",
+			change: func(c *Config) {
+				c.DoorMonitor.Doors = []Door{{Device: "rear door", Title: "Rear Door Warning", Message: "Door open"}}
+			},
+			want: []string{"door_monitor.doors[0].message:Door left open for too long -> Door open"},
+		},
+		{
+			name: "pointer in a slice element",
+			change: func(c *Config) {
+				c.DoorMonitor.Doors = []Door{{Device: "rear door", Title: "Rear Door Warning", Message: "Door left open for too long",
+					Reminders: &Reminders{Every: time.Minute}}}
+			},
+			want: []string{"door_monitor.doors[0].reminders:none -> {every:1m0s}"},
+		},
+		{
+			name:   "nil pointer",
+			change: func(c *Config) { c.Hardware = nil },
+			want: []string{"hardware:{sensors:[{name:dht22 kind:dht22 pin:4}, {name:tsl2561 kind:tsl2561 address:57}] " +
+				"temperature:dht22 light:tsl2561 led:{red:11 green:13 blue:15}} -> none (needs restart)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Default(), Default()
+			tt.change(b)
+			if got := Diff(a, b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
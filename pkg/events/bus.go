@@ -0,0 +1,119 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuffer is how many events a subscriber can fall behind by before
+// the next ones are dropped
+const DefaultBuffer = 64
+
+// Topic of an event is its kind and source, e.g. contact/158d0002676aec
+func (e Event) Topic() string {
+	return string(e.Kind) + "/" + e.Source
+}
+
+// Bus delivers published events to the subscribers of their topic. A
+// subscriber not keeping up misses events rather than holding up the
+// publisher and the other subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events of its topics
+type Subscription struct {
+	name    string
+	topics  []string
+	ch      chan Event
+	dropped uint64
+	bus     *Bus
+}
+
+// Subscribe returns a subscription to topics, either kinds such as "contact"
+// or full topics such as "contact/158d0002676aec", or to every event if none
+// are given. name shows up in the logs. Up to buffer events are queued,
+// DefaultBuffer if 0.
+func (b *Bus) Subscribe(name string, buffer int, topics ...string) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	s := &Subscription{name: name, topics: topics, ch: make(chan Event, buffer), bus: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish sends e to every subscription of its topic without waiting
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.matches(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			// log the first drop and then every hundredth
+			if n := atomic.AddUint64(&s.dropped, 1); n%100 == 1 {
+				log.Printf("events:%s falling behind, %d events dropped\n", s.name, n)
+			}
+		}
+	}
+}
+
+func (s *Subscription) matches(e Event) bool {
+	if len(s.topics) == 0 {
+		return true
+	}
+	for _, t := range s.topics {
+		if t == string(e.Kind) || t == e.Topic() {
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns the events received. It's closed when the subscription is.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events were missed because the subscriber was
+// too slow
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unsubscribes
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+// Default is the bus of the process, which the gateway listener, sensors and
+// automations publish to
+var Default = NewBus()
+
+// Publish sends e to the subscribers of the default bus
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Subscribe subscribes to topics of the default bus
+func Subscribe(name string, buffer int, topics ...string) *Subscription {
+	return Default.Subscribe(name, buffer, topics...)
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeTopics(t *testing.T) {
+	b := NewBus()
+	all := b.Subscribe("all", 0)
+	contacts := b.Subscribe("contacts", 0, "contact")
+	door := b.Subscribe("door", 0, "contact/158d0002676aec")
+	power := b.Subscribe("power", 0, "power")
+
+	b.Publish(New("158d0002676aec", Contact, Closed, Open))
+	b.Publish(New("158d000283ae42", Contact, Closed, Open))
+	b.Publish(New("158d00027b6f38", Motion, NoMotion, MotionDetected))
+
+	tests := []struct {
+		sub  *Subscription
+		want int
+	}{
+		{all, 3},
+		{contacts, 2},
+		{door, 1},
+		{power, 0},
+	}
+	for _, tt := range tests {
+		if got := len(tt.sub.Events()); got != tt.want {
+			t.Errorf("%s:got %d events, want %d", tt.sub.name, got, tt.want)
+		}
+	}
+	if e := <-door.Events(); e.Source != "158d0002676aec" || e.New != Open {
+		t.Errorf("door:got %+v", e)
+	}
+}
+
+func TestPublishDropsForSlowSubscriber(t *testing.T) {
+	b := NewBus()
+	slow := b.Subscribe("slow", 2)
+	fast := b.Subscribe("fast", 10)
+	for i := 0; i < 5; i++ {
+		b.Publish(New("plug", Power, Off, On))
+	}
+	if got := len(slow.Events()); got != 2 {
+		t.Errorf("slow:got %d events queued, want 2", got)
+	}
+	if got := slow.Dropped(); got != 3 {
+		t.Errorf("slow:Dropped = %d, want 3", got)
+	}
+	if got := len(fast.Events()); got != 5 {
+		t.Errorf("fast:got %d events queued, want 5", got)
+	}
+	if got := fast.Dropped(); got != 0 {
+		t.Errorf("fast:Dropped = %d, want 0", got)
+	}
+}
+
+func TestCloseUnblocksSubscriber(t *testing.T) {
+	b := NewBus()
+	s := b.Subscribe("closing", 0)
+	done := make(chan struct{})
+	go func() {
+		for range s.Events() {
+		}
+		close(done)
+	}()
+	s.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber still blocked after Close")
+	}
+	// closing twice and publishing afterwards must not panic
+	s.Close()
+	b.Publish(New("plug", Power, Off, On))
+}
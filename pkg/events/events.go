@@ -0,0 +1,104 @@
+// Package events is the typed model of what happens around the house, shared
+// by the commands producing and consuming events
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is what happened
+type Kind string
+
+// event kinds, with the states they go between
+const (
+	// door or window contact: Open, Closed
+	Contact Kind = "contact"
+	// motion sensor: MotionDetected, NoMotion
+	Motion Kind = "motion"
+	// smart plug: On, Off
+	Power Kind = "power"
+	// device tampered with, e.g. a vibration sensor knocked: the gateway's
+	// status such as "tilt" or "vibrate"
+	Tamper Kind = "tamper"
+	// battery voltage in mV
+	Battery Kind = "battery"
+	// device reachability: Online, Offline
+	Reachability Kind = "reachability"
+	// sensor changing too often to be trusted: Faulty, Settled
+	Flapping Kind = "flapping"
+	// sensor reading: the value, with its quantity and unit as metadata
+	Reading Kind = "reading"
+	// sunrise and sunset: Day, Night
+	Sun Kind = "sun"
+	// RGB LED color: e.g. #ff8000
+	Color Kind = "color"
+)
+
+// states
+const (
+	Open           = "open"
+	Closed         = "closed"
+	MotionDetected = "motion"
+	NoMotion       = "no_motion"
+	On             = "on"
+	Off            = "off"
+	Online         = "online"
+	Offline        = "offline"
+	Faulty         = "faulty"
+	Settled        = "settled"
+	Day            = "day"
+	Night          = "night"
+)
+
+// Event is something which happened to a device
+type Event struct {
+	// ID of the device, or the sensor name for readings
+	Source string `json:"source"`
+	Kind   Kind   `json:"kind"`
+	// state before, empty if unknown, and after
+	Old  string    `json:"old,omitempty"`
+	New  string    `json:"new"`
+	Time time.Time `json:"time"`
+	// anything else, e.g. the device name or how long a door was open
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// New creates an event happening now
+func New(source string, kind Kind, old, state string) Event {
+	return Event{Source: source, Kind: kind, Old: old, New: state, Time: time.Now(), Meta: make(map[string]string)}
+}
+
+// With returns e with a metadata value added
+func (e Event) With(key, value string) Event {
+	meta := make(map[string]string, len(e.Meta)+1)
+	for k, v := range e.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	e.Meta = meta
+	return e
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s ", e.Kind, e.Source)
+	if e.Old != "" {
+		s += e.Old + "->"
+	}
+	s += e.New
+	var keys []string
+	for k := range e.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var meta []string
+	for _, k := range keys {
+		meta = append(meta, k+"="+e.Meta[k])
+	}
+	if len(meta) > 0 {
+		s += " " + strings.Join(meta, " ")
+	}
+	return s
+}
@@ -0,0 +1,211 @@
+package hardware
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+// Config describes which sensors and LED are connected where, e.g.
+//
+//	sensors:
+//	  - {name: dht22, kind: dht22, pin: 4}
+//	  - {name: tsl2561, kind: tsl2561, bus: 0, address: 0x39}
+//	temperature: dht22
+//	light: tsl2561
+//	led: {red: "11", green: "13", blue: "15"}
+type Config struct {
+	Sensors []sensors.Spec `yaml:"sensors"`
+	// name of the sensor used for temperature and humidity
+	Temperature string `yaml:"temperature"`
+	// name of the sensor used for light
+	Light string `yaml:"light"`
+	LED   LED    `yaml:"led"`
+}
+
+// LED is a RGB LED. Pins are names of the Raspberry Pi header pins as used by
+// gobot, not GPIO numbers.
+type LED struct {
+	Red   string `yaml:"red"`
+	Green string `yaml:"green"`
+	Blue  string `yaml:"blue"`
+}
+
+// Default returns the wiring of the original setup
+func Default() *Config {
+	return &Config{
+		Sensors: []sensors.Spec{
+			{Name: "dht22", Kind: sensors.KindDHT22, Pin: 4},
+			{Name: "tsl2561", Kind: sensors.KindTSL2561, Bus: 0, Address: 0x39},
+		},
+		Temperature: "dht22",
+		Light:       "tsl2561",
+		LED:         LED{Red: "11", Green: "13", Blue: "15"},
+	}
+}
+
+// Sensor returns the sensor with the given name
+func (c *Config) Sensor(name string) (sensors.Spec, error) {
+	for _, s := range c.Sensors {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return sensors.Spec{}, fmt.Errorf("no sensor named %s", name)
+}
+
+// TemperatureSensor returns the sensor used for temperature and humidity
+func (c *Config) TemperatureSensor() (sensors.Spec, error) {
+	return c.Sensor(c.Temperature)
+}
+
+// LightSensor returns the sensor used for light
+func (c *Config) LightSensor() (sensors.Spec, error) {
+	return c.Sensor(c.Light)
+}
+
+// BCM GPIO number of each GPIO pin on the 40 pin header
+var headerGPIO = map[string]int{
+	"3": 2, "5": 3, "7": 4, "8": 14, "10": 15, "11": 17, "12": 18, "13": 27,
+	"15": 22, "16": 23, "18": 24, "19": 10, "21": 9, "22": 25, "23": 11, "24": 8,
+	"26": 7, "27": 0, "28": 1, "29": 5, "31": 6, "32": 12, "33": 13, "35": 19,
+	"36": 16, "37": 26, "38": 20, "40": 21,
+}
+
+// GPIOs used as SDA and SCL by each I2C bus
+var i2cGPIO = map[int][2]int{
+	0: {0, 1},
+	1: {2, 3},
+}
+
+// Validate checks every sensor and the LED are valid and no two devices
+// share a GPIO pin or an I2C address
+func (c *Config) Validate() error {
+	var errs []string
+	gpios := make(map[int]string)
+	claim := func(gpio int, who string) {
+		if other, ok := gpios[gpio]; ok {
+			if other != who {
+				errs = append(errs, fmt.Sprintf("%s and %s both use GPIO %d", other, who, gpio))
+			}
+			return
+		}
+		gpios[gpio] = who
+	}
+
+	names := make(map[string]bool)
+	addresses := make(map[[2]int]string)
+	for _, s := range c.Sensors {
+		if err := s.Validate(); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if names[s.Name] {
+			errs = append(errs, fmt.Sprintf("more than one sensor named %s", s.Name))
+		}
+		names[s.Name] = true
+		if !s.IsI2C() {
+			claim(s.Pin, "sensor "+s.Name)
+			continue
+		}
+		key := [2]int{s.Bus, s.Address}
+		if other, ok := addresses[key]; ok {
+			errs = append(errs, fmt.Sprintf("sensor %s and sensor %s both use I2C bus %d address %#x",
+				other, s.Name, s.Bus, s.Address))
+		}
+		addresses[key] = s.Name
+		if pins, ok := i2cGPIO[s.Bus]; ok {
+			claim(pins[0], fmt.Sprintf("I2C bus %d", s.Bus))
+			claim(pins[1], fmt.Sprintf("I2C bus %d", s.Bus))
+		}
+	}
+
+	if c.LED != (LED{}) {
+		for _, p := range []struct{ color, pin string }{
+			{"red", c.LED.Red}, {"green", c.LED.Green}, {"blue", c.LED.Blue},
+		} {
+			gpio, ok := headerGPIO[p.pin]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("LED %s:pin %q is not a GPIO header pin", p.color, p.pin))
+				continue
+			}
+			claim(gpio, "LED "+p.color)
+		}
+	}
+
+	for _, role := range []string{c.Temperature, c.Light} {
+		if role != "" && !names[role] {
+			errs = append(errs, fmt.Sprintf("no sensor named %s", role))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid hardware config:" + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Flags are command line overrides of the hardware config
+type Flags struct {
+	temperature *string
+	light       *string
+	led         *string
+}
+
+// RegisterFlags adds -temp-sensor, -light-sensor and -led to fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		temperature: fs.String("temp-sensor", "",
+			"temperature sensor: a name from the config, dht22[@gpio], bme280[@bus:address] or sht31[@bus:address]"),
+		light: fs.String("light-sensor", "",
+			"light sensor: a name from the config, tsl2561[@bus:address] or bh1750[@bus:address]"),
+		led: fs.String("led", "", "header pin names of the RGB LED as red,green,blue, e.g. 11,13,15"),
+	}
+}
+
+// Apply applies the flag overrides to c and validates the result
+func (f *Flags) Apply(c *Config) error {
+	if err := c.override(&c.Temperature, *f.temperature); err != nil {
+		return err
+	}
+	if err := c.override(&c.Light, *f.light); err != nil {
+		return err
+	}
+	if *f.led != "" {
+		pins := strings.Split(*f.led, ",")
+		if len(pins) != 3 {
+			return fmt.Errorf("invalid -led %s:expecting red,green,blue", *f.led)
+		}
+		c.LED = LED{Red: pins[0], Green: pins[1], Blue: pins[2]}
+	}
+	return c.Validate()
+}
+
+// override points role to a configured sensor by name, or replaces the sensor
+// currently in that role with the one described by value
+func (c *Config) override(role *string, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := c.Sensor(value); err == nil {
+		*role = value
+		return nil
+	}
+	spec, err := sensors.ParseSpec(value)
+	if err != nil {
+		return err
+	}
+	var kept []sensors.Spec
+	for _, s := range c.Sensors {
+		// keep the old sensor if it's still used in another role
+		if s.Name != spec.Name && (s.Name != *role || s.Name == c.Temperature && s.Name == c.Light) {
+			kept = append(kept, s)
+		}
+	}
+	c.Sensors = append(kept, spec)
+	*role = spec.Name
+	return nil
+}
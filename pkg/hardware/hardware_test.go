@@ -0,0 +1,88 @@
+package hardware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/starryalley/smart_home/pkg/sensors"
+)
+
+func TestValidate(t *testing.T) {
+	dht := sensors.Spec{Name: "dht22", Kind: sensors.KindDHT22, Pin: 4}
+	tsl := sensors.Spec{Name: "tsl2561", Kind: sensors.KindTSL2561, Bus: 0, Address: 0x39}
+	led := LED{Red: "11", Green: "13", Blue: "15"}
+	tests := []struct {
+		name string
+		cfg  Config
+		// substring of the error, valid if empty
+		err string
+	}{
+		{
+			name: "default",
+			cfg:  *Default(),
+		},
+		{
+			name: "two sensors on one bus",
+			cfg: Config{Sensors: []sensors.Spec{
+				{Name: "bme", Kind: sensors.KindBME280, Bus: 1, Address: 0x76},
+				{Name: "light", Kind: sensors.KindBH1750, Bus: 1, Address: 0x23},
+			}},
+		},
+		{
+			name: "no LED",
+			cfg:  Config{Sensors: []sensors.Spec{dht}, Temperature: "dht22"},
+		},
+		{
+			name: "same I2C address",
+			cfg: Config{Sensors: []sensors.Spec{tsl,
+				{Name: "other", Kind: sensors.KindTSL2561, Bus: 0, Address: 0x39}}},
+			err: "sensor tsl2561 and sensor other both use I2C bus 0 address 0x39",
+		},
+		{
+			name: "same name",
+			cfg:  Config{Sensors: []sensors.Spec{dht, {Name: "dht22", Kind: sensors.KindDHT22, Pin: 17}}},
+			err:  "more than one sensor named dht22",
+		},
+		{
+			name: "DHT22 on the LED pin",
+			cfg:  Config{Sensors: []sensors.Spec{{Name: "dht22", Kind: sensors.KindDHT22, Pin: 17}}, LED: led},
+			err:  "sensor dht22 and LED red both use GPIO 17",
+		},
+		{
+			name: "DHT22 on an I2C pin",
+			cfg:  Config{Sensors: []sensors.Spec{tsl, {Name: "dht22", Kind: sensors.KindDHT22, Pin: 1}}},
+			err:  "I2C bus 0 and sensor dht22 both use GPIO 1",
+		},
+		{
+			name: "LED colors on one pin",
+			cfg:  Config{LED: LED{Red: "11", Green: "11", Blue: "15"}},
+			err:  "LED red and LED green both use GPIO 17",
+		},
+		{
+			name: "LED on a power pin",
+			cfg:  Config{LED: LED{Red: "11", Green: "13", Blue: "2"}},
+			err:  `LED blue:pin "2" is not a GPIO header pin`,
+		},
+		{
+			name: "unknown kind",
+			cfg:  Config{Sensors: []sensors.Spec{{Name: "x", Kind: "dht11"}}},
+			err:  "sensor x:unknown kind dht11",
+		},
+		{
+			name: "missing role",
+			cfg:  Config{Sensors: []sensors.Spec{dht}, Temperature: "dht22", Light: "tsl2561"},
+			err:  "no sensor named tsl2561",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error:%v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
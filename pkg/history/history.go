@@ -0,0 +1,84 @@
+// Package history keeps the door open/close transitions in a local file, one
+// JSON record per line, and computes statistics from them
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record is a door transition
+type Record struct {
+	// device name of the door
+	Door string    `json:"door"`
+	Open bool      `json:"open"`
+	Time time.Time `json:"time"`
+	// how long the door was open, on closing
+	Duration time.Duration `json:"duration,omitempty"`
+	// the door closed while door_monitor wasn't running, so how long it was
+	// open isn't known
+	DurationUnknown bool `json:"duration_unknown,omitempty"`
+}
+
+// Store appends records to a file
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a store writing to path, nothing is kept if path is empty
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Append adds r to the end of the file
+func (s *Store) Append(r Record) error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the records at path from since on, oldest first
+func Read(path string, since time.Time) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d:%v", path, line, err)
+		}
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,89 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Humanize formats d as e.g. "47 minutes"
+func Humanize(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < 2*time.Minute:
+		return "1 minute"
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%.1f hours", d.Hours())
+}
+
+// Stats of one door
+type Stats struct {
+	Door string
+	// openings by day, as 2006-01-02
+	PerDay map[string]int
+	// longest time open and when it started
+	Longest      time.Duration
+	LongestStart time.Time
+	// of the openings which were closed
+	Average time.Duration
+	// openings by hour of day
+	ByHour [24]int
+	// openings and how many of them were closed, leaving out those which
+	// closed while door_monitor wasn't running
+	Openings int
+	Closed   int
+}
+
+// Days returns the days with openings, in order
+func (s *Stats) Days() []string {
+	var days []string
+	for day := range s.PerDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// Compute returns the stats of every door in records, by door name
+func Compute(records []Record) []*Stats {
+	byDoor := make(map[string]*Stats)
+	var doors []string
+	total := make(map[string]time.Duration)
+	for _, r := range records {
+		s, ok := byDoor[r.Door]
+		if !ok {
+			s = &Stats{Door: r.Door, PerDay: make(map[string]int)}
+			byDoor[r.Door] = s
+			doors = append(doors, r.Door)
+		}
+		t := r.Time.Local()
+		if r.Open {
+			s.Openings++
+			s.PerDay[t.Format("2006-01-02")]++
+			s.ByHour[t.Hour()]++
+			continue
+		}
+		if r.DurationUnknown {
+			continue
+		}
+		s.Closed++
+		total[r.Door] += r.Duration
+		if r.Duration > s.Longest {
+			s.Longest, s.LongestStart = r.Duration, t.Add(-r.Duration)
+		}
+	}
+
+	sort.Strings(doors)
+	var stats []*Stats
+	for _, door := range doors {
+		s := byDoor[door]
+		if s.Closed > 0 {
+			s.Average = total[door] / time.Duration(s.Closed)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
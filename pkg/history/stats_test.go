@@ -0,0 +1,80 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	day := func(d, hour, min int) time.Time {
+		return time.Date(2020, 5, d, hour, min, 0, 0, time.Local)
+	}
+	open := func(door string, t time.Time) Record {
+		return Record{Door: door, Open: true, Time: t}
+	}
+	closed := func(door string, t time.Time, d time.Duration) Record {
+		return Record{Door: door, Time: t, Duration: d}
+	}
+	records := []Record{
+		open("rear door", day(1, 8, 0)),
+		closed("rear door", day(1, 8, 10), 10*time.Minute),
+		open("front door", day(1, 9, 0)),
+		open("rear door", day(1, 18, 0)),
+		closed("rear door", day(1, 19, 0), time.Hour),
+		// closed while door_monitor wasn't running
+		open("rear door", day(2, 8, 30)),
+		{Door: "rear door", Time: day(2, 22, 0), DurationUnknown: true},
+		open("rear door", day(3, 8, 45)),
+		closed("rear door", day(3, 8, 50), 5*time.Minute),
+	}
+	stats := Compute(records)
+	if len(stats) != 2 || stats[0].Door != "front door" || stats[1].Door != "rear door" {
+		t.Fatalf("stats for %v", stats)
+	}
+
+	front := stats[0]
+	if front.Openings != 1 || front.Closed != 0 || front.Longest != 0 || front.Average != 0 {
+		t.Errorf("front door = %+v", front)
+	}
+
+	rear := stats[1]
+	if rear.Openings != 4 || rear.Closed != 3 {
+		t.Errorf("rear door openings %d closed %d, want 4 and 3", rear.Openings, rear.Closed)
+	}
+	if rear.Longest != time.Hour || !rear.LongestStart.Equal(day(1, 18, 0)) {
+		t.Errorf("rear door longest %v from %v", rear.Longest, rear.LongestStart)
+	}
+	if rear.Average != 25*time.Minute {
+		t.Errorf("rear door average %v, want 25m", rear.Average)
+	}
+	if want := map[string]int{"2020-05-01": 2, "2020-05-02": 1, "2020-05-03": 1}; !reflect.DeepEqual(rear.PerDay, want) {
+		t.Errorf("rear door per day %v", rear.PerDay)
+	}
+	if days := rear.Days(); !reflect.DeepEqual(days, []string{"2020-05-01", "2020-05-02", "2020-05-03"}) {
+		t.Errorf("rear door days %v", days)
+	}
+	var byHour [24]int
+	byHour[8], byHour[18] = 3, 1
+	if rear.ByHour != byHour {
+		t.Errorf("rear door by hour %v", rear.ByHour)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{45 * time.Second, "45 seconds"},
+		{90 * time.Second, "1 minute"},
+		{47 * time.Minute, "47 minutes"},
+		{119 * time.Minute, "119 minutes"},
+		{150 * time.Minute, "2.5 hours"},
+	}
+	for _, tt := range tests {
+		if got := Humanize(tt.d); got != tt.want {
+			t.Errorf("Humanize(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
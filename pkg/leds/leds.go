@@ -0,0 +1,28 @@
+package leds
+
+import (
+	"log"
+	"sync"
+)
+
+// RGB is a RGB LED. gpio.RgbLedDriver implements this.
+type RGB interface {
+	SetRGB(r, g, b byte) error
+}
+
+// Simulated is a RGB LED which only logs colour changes
+type Simulated struct {
+	mu      sync.Mutex
+	r, g, b byte
+}
+
+// SetRGB logs the new colour if it's different from the current one
+func (l *Simulated) SetRGB(r, g, b byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.r != r || l.g != g || l.b != b {
+		log.Printf("[sim] LED:%v,%v,%v\n", r, g, b)
+		l.r, l.g, l.b = r, g, b
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package miio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is an error returned by the device
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("miio error %d:%s", e.Code, e.Message)
+}
+
+type request struct {
+	ID     uint32      `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+type response struct {
+	ID     uint32          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Client talks to a single miIO device, such as the Xiaomi gateway
+type Client struct {
+	// how long to wait for each reply
+	Timeout time.Duration
+	// how many times a call is sent before giving up
+	Retries int
+
+	addr  string
+	token Token
+
+	mu sync.Mutex
+	// learnt in the handshake
+	deviceID uint32
+	stamp    uint32
+	stampAt  time.Time
+	lastID   uint32
+}
+
+// NewClient creates a client for the device at address (host or host:port)
+// with the given hex token
+func NewClient(address, token string) (*Client, error) {
+	t, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(Port))
+	}
+	return &Client{
+		Timeout: 2 * time.Second,
+		Retries: 3,
+		addr:    address,
+		token:   t,
+	}, nil
+}
+
+// Call invokes method with params and unmarshals the result into result,
+// which may be nil
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if params == nil {
+		params = []interface{}{}
+	}
+	conn, err := net.Dial("udp", c.addr)
+	if err != nil {
+		return fmt.Errorf("miio:%v", err)
+	}
+	defer conn.Close()
+
+	for i := 0; ; i++ {
+		var resp *response
+		if resp, err = c.call(conn, method, params); err == nil {
+			if resp.Error != nil {
+				return resp.Error
+			}
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(resp.Result, result)
+		}
+		// the device may have rebooted, handshake again on retry
+		c.stampAt = time.Time{}
+		if i+1 >= c.Retries {
+			return fmt.Errorf("miio %s %s:%v", c.addr, method, err)
+		}
+	}
+}
+
+func (c *Client) call(conn net.Conn, method string, params interface{}) (*response, error) {
+	if c.stampAt.IsZero() {
+		if err := c.handshake(conn); err != nil {
+			return nil, err
+		}
+	}
+	c.lastID++
+	payload, err := json.Marshal(request{ID: c.lastID, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	stamp := c.stamp + uint32(time.Since(c.stampAt)/time.Second)
+	if _, err := conn.Write(encode(c.token, c.deviceID, stamp, payload)); err != nil {
+		return nil, err
+	}
+	for {
+		b, err := c.receive(conn)
+		if err != nil {
+			return nil, err
+		}
+		_, payload, err := decode(c.token, b)
+		if err != nil {
+			return nil, err
+		}
+		// some firmwares pad the JSON with NUL bytes
+		payload = bytes.TrimRight(payload, "\x00")
+		var resp response
+		if err := json.Unmarshal(payload, &resp); err != nil {
+			return nil, fmt.Errorf("invalid reply %q:%v", payload, err)
+		}
+		// ignore late replies to earlier attempts
+		if resp.ID == c.lastID {
+			return &resp, nil
+		}
+	}
+}
+
+// handshake learns the device ID and clock
+func (c *Client) handshake(conn net.Conn) error {
+	if _, err := conn.Write(hello); err != nil {
+		return err
+	}
+	b, err := c.receive(conn)
+	if err != nil {
+		return fmt.Errorf("handshake:%v", err)
+	}
+	h, _, err := decode(c.token, b)
+	if err != nil {
+		return fmt.Errorf("handshake:%v", err)
+	}
+	c.deviceID, c.stamp, c.stampAt = h.DeviceID, h.Stamp, time.Now()
+	return nil
+}
+
+func (c *Client) receive(conn net.Conn) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(c.Timeout))
+	b := make([]byte, 4096)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
@@ -0,0 +1,191 @@
+package miio
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testToken  = "00112233445566778899aabbccddeeff"
+	otherToken = "ffeeddccbbaa99887766554433221100"
+	testID     = 0x0badcafe
+)
+
+// echo answers "echo" with its params and everything else with an *Error
+func echo(method string, params json.RawMessage) (interface{}, error) {
+	if method != "echo" {
+		return nil, &Error{Code: -5001, Message: "unknown method " + method}
+	}
+	return params, nil
+}
+
+func listen(t *testing.T, handler Handler) *Device {
+	t.Helper()
+	d, err := ListenDevice("127.0.0.1:0", testID, testToken, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func newClient(t *testing.T, address, token string) *Client {
+	t.Helper()
+	c, err := NewClient(address, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = 200 * time.Millisecond
+	return c
+}
+
+func TestCall(t *testing.T) {
+	d := listen(t, echo)
+	defer d.Close()
+	c := newClient(t, d.Addr(), testToken)
+
+	for i := 0; i < 2; i++ {
+		var got []string
+		if err := c.Call("echo", []string{"get_prop", "power"}, &got); err != nil {
+			t.Fatalf("call %d:%v", i, err)
+		}
+		if len(got) != 2 || got[0] != "get_prop" || got[1] != "power" {
+			t.Errorf("call %d = %q", i, got)
+		}
+	}
+	if c.deviceID != testID {
+		t.Errorf("device ID = %#x, want %#x", c.deviceID, testID)
+	}
+	if c.lastID != 2 {
+		t.Errorf("request ID = %d, want 2", c.lastID)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	d := listen(t, echo)
+	defer d.Close()
+	c := newClient(t, d.Addr(), testToken)
+
+	err := c.Call("toggle", nil, nil)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("error = %v (%T), want *Error", err, err)
+	}
+	if e.Code != -5001 || e.Message != "unknown method toggle" {
+		t.Errorf("error = %+v", e)
+	}
+}
+
+func TestWrongToken(t *testing.T) {
+	d := listen(t, echo)
+	defer d.Close()
+	c := newClient(t, d.Addr(), otherToken)
+	c.Retries = 1
+
+	// the device drops requests it can't verify, so the client times out
+	if err := c.Call("echo", nil, nil); err == nil {
+		t.Fatal("call with the wrong token succeeded")
+	}
+
+	// and a reply encrypted with another token is rejected
+	packet := encode(mustToken(t, testToken), testID, 1, []byte(`{"id":1,"result":["ok"]}`))
+	if _, _, err := decode(mustToken(t, otherToken), packet); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("decode with the wrong token:%v, want checksum mismatch", err)
+	}
+	if _, payload, err := decode(mustToken(t, testToken), packet); err != nil || string(payload) != `{"id":1,"result":["ok"]}` {
+		t.Errorf("decode = %q, %v", payload, err)
+	}
+}
+
+func TestRetryAfterDroppedReply(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	d := listen(t, func(method string, params json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return "ok", nil
+	})
+	defer d.Close()
+	p, stop := dropFirstReply(t, d.Addr())
+	defer stop()
+	c := newClient(t, p, testToken)
+
+	var got string
+	if err := c.Call("get_prop", nil, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "ok" {
+		t.Errorf("result = %q", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("device got %d calls, want 2", calls)
+	}
+}
+
+func mustToken(t *testing.T, s string) Token {
+	t.Helper()
+	token, err := ParseToken(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// dropFirstReply relays packets between a client and the device at address,
+// losing the first reply which isn't a handshake. It returns the address to
+// point the client at and a function stopping the relay.
+func dropFirstReply(t *testing.T, address string) (string, func()) {
+	t.Helper()
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := make(chan *net.UDPAddr, 1)
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			n, from, err := front.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			select {
+			case clients <- from:
+			default:
+			}
+			back.Write(b[:n])
+		}
+	}()
+	go func() {
+		client := <-clients
+		dropped := false
+		b := make([]byte, 4096)
+		for {
+			n, err := back.Read(b)
+			if err != nil {
+				return
+			}
+			if !dropped && n > headerSize {
+				dropped = true
+				continue
+			}
+			front.WriteToUDP(b[:n], client)
+		}
+	}()
+	return front.LocalAddr().String(), func() {
+		front.Close()
+		back.Close()
+	}
+}
@@ -0,0 +1,129 @@
+// Package miio implements the Xiaomi miIO LAN protocol: JSON-RPC over UDP,
+// encrypted with the device token.
+package miio
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Port is the UDP port miIO devices listen on
+const Port = 54321
+
+const (
+	magic      = 0x2131
+	headerSize = 32
+)
+
+// header is the unencrypted 32 byte packet header
+type header struct {
+	Magic    uint16
+	Length   uint16
+	Unknown  uint32
+	DeviceID uint32
+	Stamp    uint32
+	Checksum [16]byte
+}
+
+// hello is sent to discover a device's ID and clock. The device answers with
+// a header only packet.
+var hello = func() []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(b, magic)
+	binary.BigEndian.PutUint16(b[2:], headerSize)
+	for i := 4; i < headerSize; i++ {
+		b[i] = 0xff
+	}
+	return b
+}()
+
+// Token is the 16 byte device token used to derive the AES key
+type Token []byte
+
+// ParseToken parses a 32 character hex token
+func ParseToken(s string) (Token, error) {
+	t, err := hex.DecodeString(s)
+	if err != nil || len(t) != 16 {
+		return nil, fmt.Errorf("invalid miio token:%q", s)
+	}
+	return t, nil
+}
+
+// key = md5(token), iv = md5(key + token)
+func (t Token) keyIV() ([]byte, []byte) {
+	key := md5.Sum(t)
+	iv := md5.Sum(append(key[:], t...))
+	return key[:], iv[:]
+}
+
+func (t Token) encrypt(data []byte) []byte {
+	key, iv := t.keyIV()
+	block, _ := aes.NewCipher(key)
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+func (t Token) decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("miio:invalid encrypted payload size")
+	}
+	key, iv := t.keyIV()
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errors.New("miio:invalid padding, wrong token?")
+	}
+	return out[:len(out)-pad], nil
+}
+
+// checksum is md5 over the header with the token in place of the checksum,
+// followed by the encrypted payload
+func (t Token) checksum(h []byte, data []byte) [16]byte {
+	b := append(append(append([]byte{}, h[:16]...), t...), data...)
+	return md5.Sum(b)
+}
+
+// encode builds an encrypted packet carrying payload
+func encode(t Token, deviceID, stamp uint32, payload []byte) []byte {
+	data := t.encrypt(payload)
+	b := make([]byte, headerSize, headerSize+len(data))
+	binary.BigEndian.PutUint16(b, magic)
+	binary.BigEndian.PutUint16(b[2:], uint16(headerSize+len(data)))
+	binary.BigEndian.PutUint32(b[8:], deviceID)
+	binary.BigEndian.PutUint32(b[12:], stamp)
+	sum := t.checksum(b, data)
+	copy(b[16:], sum[:])
+	return append(b, data...)
+}
+
+// decode parses a packet, verifying and decrypting its payload if there is one
+func decode(t Token, b []byte) (header, []byte, error) {
+	var h header
+	if len(b) < headerSize {
+		return h, nil, fmt.Errorf("miio:short packet (%d bytes)", len(b))
+	}
+	binary.Read(bytes.NewReader(b[:headerSize]), binary.BigEndian, &h)
+	if h.Magic != magic || int(h.Length) != len(b) {
+		return h, nil, errors.New("miio:invalid packet header")
+	}
+	data := b[headerSize:]
+	if len(data) == 0 {
+		return h, nil, nil
+	}
+	if t.checksum(b, data) != h.Checksum {
+		return h, nil, errors.New("miio:checksum mismatch, wrong token?")
+	}
+	payload, err := t.decrypt(data)
+	return h, payload, err
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// post sends body to u and checks the reply is 2xx. Errors don't include u,
+// which may carry a key or token.
+func post(ctx context.Context, name, u, contentType string, body io.Reader, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return postError(name, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return postError(name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		content, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s:%s:%s", name, resp.Status, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+// postError strips the URL from err
+func postError(name string, err error) error {
+	if e, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%s:%s failed:%v", name, strings.ToLower(e.Op), e.Err)
+	}
+	return fmt.Errorf("%s:%v", name, err)
+}
+
+func postJSON(ctx context.Context, name, u string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return post(ctx, name, u, "application/json", bytes.NewReader(b), nil)
+}
+
+// Webhook posts messages as JSON to any URL:
+//
+//	{"event":"door_open","title":"...","message":"...","priority":0}
+type Webhook struct {
+	URL string
+}
+
+// Notify posts m to the webhook
+func (w *Webhook) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, "webhook", w.URL, map[string]interface{}{
+		"event":    m.Event,
+		"title":    m.Title,
+		"message":  m.Body,
+		"priority": m.Priority,
+	})
+}
+
+// IFTTT triggers an IFTTT webhook event with the title as value1 and the body
+// as value2
+type IFTTT struct {
+	// webhooks server, the public one if empty
+	URL string
+	Key string
+	// event triggered, the message event if empty
+	Event string
+}
+
+// Notify triggers the event
+func (i *IFTTT) Notify(ctx context.Context, m Message) error {
+	event := i.Event
+	if event == "" {
+		event = m.Event
+	}
+	server := i.URL
+	if server == "" {
+		server = "https://maker.ifttt.com"
+	}
+	u := fmt.Sprintf("%s/trigger/%s/with/key/%s", strings.TrimSuffix(server, "/"), event, i.Key)
+	return postJSON(ctx, "ifttt", u, map[string]string{
+		"value1": m.Title,
+		"value2": m.Body,
+	})
+}
+
+// Ntfy publishes to a ntfy topic
+type Ntfy struct {
+	// server, https://ntfy.sh if empty
+	URL   string
+	Topic string
+	// access token for protected topics
+	Token string
+}
+
+// Notify publishes m to the topic
+func (n *Ntfy) Notify(ctx context.Context, m Message) error {
+	server := n.URL
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	header := http.Header{"Title": {m.Title}, "Priority": {"default"}}
+	if m.Priority == PriorityHigh {
+		header.Set("Priority", "urgent")
+	}
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+	u := strings.TrimSuffix(server, "/") + "/" + url.PathEscape(n.Topic)
+	return post(ctx, "ntfy", u, "text/plain", strings.NewReader(m.Body), header)
+}
+
+// Gotify sends to a Gotify server with an application token
+type Gotify struct {
+	URL   string
+	Token string
+}
+
+// Notify sends m to the server
+func (g *Gotify) Notify(ctx context.Context, m Message) error {
+	priority := 5
+	if m.Priority == PriorityHigh {
+		priority = 8
+	}
+	u := strings.TrimSuffix(g.URL, "/") + "/message?token=" + url.QueryEscape(g.Token)
+	return postJSON(ctx, "gotify", u, map[string]interface{}{
+		"title":    m.Title,
+		"message":  m.Body,
+		"priority": priority,
+	})
+}
+
+// Pushover sends with the Pushover API
+type Pushover struct {
+	// API endpoint, the public one if empty
+	URL string
+	// application token and user key
+	Token string
+	User  string
+}
+
+// Notify sends m to the user
+func (p *Pushover) Notify(ctx context.Context, m Message) error {
+	u := p.URL
+	if u == "" {
+		u = "https://api.pushover.net/1/messages.json"
+	}
+	form := url.Values{
+		"token":    {p.Token},
+		"user":     {p.User},
+		"title":    {m.Title},
+		"message":  {m.Body},
+		"priority": {"0"},
+	}
+	if m.Priority == PriorityHigh {
+		form.Set("priority", "1")
+	}
+	return post(ctx, "pushover", u, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil)
+}
+
+// Telegram sends with a Telegram bot to a chat
+type Telegram struct {
+	// Bot API server, the public one if empty
+	URL    string
+	Token  string
+	ChatID string
+}
+
+// Notify sends m to the chat
+func (t *Telegram) Notify(ctx context.Context, m Message) error {
+	server := t.URL
+	if server == "" {
+		server = "https://api.telegram.org"
+	}
+	u := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(server, "/"), t.Token)
+	return postJSON(ctx, "telegram", u, map[string]interface{}{
+		"chat_id": t.ChatID,
+		"text":    m.Title + "\n" + m.Body,
+	})
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// request is what a backend sent to the stand-in server
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   string
+}
+
+// standIn records the requests it gets and answers with status
+func standIn(status int) (*httptest.Server, <-chan request) {
+	requests := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.Method, r.URL.Path, r.URL.Query(), r.Header, string(b)}
+		w.WriteHeader(status)
+		w.Write([]byte("stand-in reply"))
+	}))
+	return srv, requests
+}
+
+func jsonBody(t *testing.T, r request) map[string]interface{} {
+	t.Helper()
+	if ct := r.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(r.body), &v); err != nil {
+		t.Fatalf("body %q:%v", r.body, err)
+	}
+	return v
+}
+
+var (
+	doorOpen = Message{Event: "door_open", Title: "Rear Door Warning", Body: "Door left open for too long"}
+	urgent   = Message{Event: "door_open_urgent", Title: "Rear Door Warning", Body: "Still open", Priority: PriorityHigh}
+)
+
+func TestHTTPBackends(t *testing.T) {
+	srv, requests := standIn(http.StatusOK)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		notifier Notifier
+		m        Message
+		check    func(t *testing.T, r request)
+	}{
+		{
+			name:     "webhook",
+			notifier: &Webhook{URL: srv.URL + "/hook"},
+			m:        doorOpen,
+			check: func(t *testing.T, r request) {
+				want := map[string]interface{}{"event": "door_open", "title": "Rear Door Warning",
+					"message": "Door left open for too long", "priority": 0.0}
+				if r.path != "/hook" || !reflect.DeepEqual(jsonBody(t, r), want) {
+					t.Errorf("got %s %s", r.path, r.body)
+				}
+			},
+		},
+		{
+			name:     "ifttt",
+			notifier: &IFTTT{URL: srv.URL + "/", Key: "secret-key"},
+			m:        doorOpen,
+			check: func(t *testing.T, r request) {
+				want := map[string]interface{}{"value1": "Rear Door Warning", "value2": "Door left open for too long"}
+				if r.path != "/trigger/door_open/with/key/secret-key" || !reflect.DeepEqual(jsonBody(t, r), want) {
+					t.Errorf("got %s %s", r.path, r.body)
+				}
+			},
+		},
+		{
+			name:     "ifttt event",
+			notifier: &IFTTT{URL: srv.URL, Key: "secret-key", Event: "door"},
+			m:        doorOpen,
+			check: func(t *testing.T, r request) {
+				if r.path != "/trigger/door/with/key/secret-key" {
+					t.Errorf("path = %s", r.path)
+				}
+			},
+		},
+		{
+			name:     "ntfy",
+			notifier: &Ntfy{URL: srv.URL, Topic: "my topic"},
+			m:        doorOpen,
+			check: func(t *testing.T, r request) {
+				if r.path != "/my topic" || r.body != doorOpen.Body {
+					t.Errorf("got %s %q", r.path, r.body)
+				}
+				if r.header.Get("Title") != doorOpen.Title || r.header.Get("Priority") != "default" ||
+					r.header.Get("Authorization") != "" || r.header.Get("Content-Type") != "text/plain" {
+					t.Errorf("headers = %v", r.header)
+				}
+			},
+		},
+		{
+			name:     "ntfy urgent with token",
+			notifier: &Ntfy{URL: srv.URL, Topic: "doors", Token: "tk_secret"},
+			m:        urgent,
+			check: func(t *testing.T, r request) {
+				if r.header.Get("Priority") != "urgent" || r.header.Get("Authorization") != "Bearer tk_secret" {
+					t.Errorf("headers = %v", r.header)
+				}
+			},
+		},
+		{
+			name:     "gotify",
+			notifier: &Gotify{URL: srv.URL + "/", Token: "app&token"},
+			m:        urgent,
+			check: func(t *testing.T, r request) {
+				want := map[string]interface{}{"title": "Rear Door Warning", "message": "Still open", "priority": 8.0}
+				if r.path != "/message" || r.query.Get("token") != "app&token" || !reflect.DeepEqual(jsonBody(t, r), want) {
+					t.Errorf("got %s %v %s", r.path, r.query, r.body)
+				}
+			},
+		},
+		{
+			name:     "pushover",
+			notifier: &Pushover{URL: srv.URL + "/1/messages.json", Token: "app-token", User: "user-key"},
+			m:        urgent,
+			check: func(t *testing.T, r request) {
+				form, err := url.ParseQuery(r.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := url.Values{"token": {"app-token"}, "user": {"user-key"}, "title": {"Rear Door Warning"},
+					"message": {"Still open"}, "priority": {"1"}}
+				if r.path != "/1/messages.json" || !reflect.DeepEqual(form, want) {
+					t.Errorf("got %s %v", r.path, form)
+				}
+				if ct := r.header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+			},
+		},
+		{
+			name:     "telegram",
+			notifier: &Telegram{URL: srv.URL, Token: "123:bot-token", ChatID: "-42"},
+			m:        doorOpen,
+			check: func(t *testing.T, r request) {
+				want := map[string]interface{}{"chat_id": "-42", "text": "Rear Door Warning\nDoor left open for too long"}
+				if r.path != "/bot123:bot-token/sendMessage" || !reflect.DeepEqual(jsonBody(t, r), want) {
+					t.Errorf("got %s %s", r.path, r.body)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.notifier.Notify(context.Background(), tt.m); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if r.method != http.MethodPost {
+				t.Errorf("method = %s", r.method)
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestHTTPErrorsHideSecrets(t *testing.T) {
+	srv, _ := standIn(http.StatusUnauthorized)
+	defer srv.Close()
+	// nothing listens here once closed
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for _, u := range []string{srv.URL, down.URL} {
+		notifiers := map[string]Notifier{
+			"ifttt":    &IFTTT{URL: u, Key: "secret-key"},
+			"gotify":   &Gotify{URL: u, Token: "secret-token"},
+			"telegram": &Telegram{URL: u, Token: "secret-token", ChatID: "1"},
+		}
+		for name, n := range notifiers {
+			err := n.Notify(context.Background(), doorOpen)
+			if err == nil {
+				t.Fatalf("%s to %s succeeded", name, u)
+			}
+			if !strings.HasPrefix(err.Error(), name+":") || strings.Contains(err.Error(), "secret") {
+				t.Errorf("%s error:%v", name, err)
+			}
+		}
+	}
+}
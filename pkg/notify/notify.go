@@ -0,0 +1,164 @@
+// Package notify sends alerts to our phones and mailboxes through a choice
+// of backends
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long Send waits for a notification to be delivered
+const DefaultTimeout = 30 * time.Second
+
+// Priority of a message, for backends supporting it
+type Priority int
+
+// message priorities
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+// Message is a notification
+type Message struct {
+	// what happened, e.g. door_open, used to pick the notifiers
+	Event    string
+	Title    string
+	Body     string
+	Priority Priority
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// Multi sends to all its notifiers, returning the errors of those failing
+type Multi []Notifier
+
+// Notify sends m to every notifier
+func (n Multi) Notify(ctx context.Context, m Message) error {
+	var errs []string
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, m); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Log only logs messages, for running without sending anything
+type Log struct{}
+
+// Notify logs m
+func (Log) Notify(ctx context.Context, m Message) error {
+	log.Printf("[sim] Notification %s:%s:%s\n", m.Event, m.Title, m.Body)
+	return nil
+}
+
+// Send sends m, waiting at most DefaultTimeout
+func Send(n Notifier, m Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return n.Notify(ctx, m)
+}
+
+// backend types
+const (
+	TypeWebhook  = "webhook"
+	TypeIFTTT    = "ifttt"
+	TypeNtfy     = "ntfy"
+	TypeGotify   = "gotify"
+	TypePushover = "pushover"
+	TypeTelegram = "telegram"
+	TypeSMTP     = "smtp"
+)
+
+// Spec configures a notifier. Which fields are used depends on Type:
+//
+//	webhook:  url
+//	ifttt:    key, event (defaults to the message event), url
+//	ntfy:     topic, url (defaults to https://ntfy.sh), token
+//	gotify:   url, token
+//	pushover: token, user, url
+//	telegram: token, chat_id, url
+//	smtp:     host, port, username, password, from, to
+//
+// and all of them quiet_hours.
+type Spec struct {
+	Type     string   `yaml:"type"`
+	URL      string   `yaml:"url,omitempty"`
+	Token    string   `yaml:"token,omitempty"`
+	Key      string   `yaml:"key,omitempty"`
+	Event    string   `yaml:"event,omitempty"`
+	Topic    string   `yaml:"topic,omitempty"`
+	User     string   `yaml:"user,omitempty"`
+	ChatID   string   `yaml:"chat_id,omitempty"`
+	Host     string   `yaml:"host,omitempty"`
+	Port     int      `yaml:"port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+
+	QuietHours *QuietHours `yaml:"quiet_hours,omitempty"`
+}
+
+// Validate checks the fields needed by the backend are set
+func (s Spec) Validate() error {
+	var missing bool
+	switch s.Type {
+	case TypeWebhook:
+		missing = s.URL == ""
+	case TypeIFTTT:
+		missing = s.Key == ""
+	case TypeNtfy:
+		missing = s.Topic == ""
+	case TypeGotify:
+		missing = s.URL == "" || s.Token == ""
+	case TypePushover:
+		missing = s.Token == "" || s.User == ""
+	case TypeTelegram:
+		missing = s.Token == "" || s.ChatID == ""
+	case TypeSMTP:
+		missing = s.Host == "" || s.From == "" || len(s.To) == 0
+	default:
+		return fmt.Errorf("unknown notifier type:%q", s.Type)
+	}
+	if missing {
+		return fmt.Errorf("%s notifier:missing settings", s.Type)
+	}
+	if s.QuietHours != nil {
+		return s.QuietHours.Validate()
+	}
+	return nil
+}
+
+// Open creates the notifier described by s
+func Open(s Spec) (Notifier, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	switch s.Type {
+	case TypeWebhook:
+		return &Webhook{URL: s.URL}, nil
+	case TypeIFTTT:
+		return &IFTTT{URL: s.URL, Key: s.Key, Event: s.Event}, nil
+	case TypeNtfy:
+		return &Ntfy{URL: s.URL, Topic: s.Topic, Token: s.Token}, nil
+	case TypeGotify:
+		return &Gotify{URL: s.URL, Token: s.Token}, nil
+	case TypePushover:
+		return &Pushover{URL: s.URL, Token: s.Token, User: s.User}, nil
+	case TypeTelegram:
+		return &Telegram{URL: s.URL, Token: s.Token, ChatID: s.ChatID}, nil
+	}
+	return &SMTP{Host: s.Host, Port: s.Port, Username: s.Username, Password: s.Password, From: s.From, To: s.To}, nil
+}
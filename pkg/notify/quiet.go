@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is when a notifier shouldn't disturb us, e.g. 22:00 to 07:00
+type QuietHours struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// bundle the messages held back into one sent when quiet hours end,
+	// instead of dropping them
+	Digest bool `yaml:"digest"`
+	// let high priority messages through anyway
+	Urgent bool `yaml:"urgent"`
+}
+
+// minutes since midnight of "15:04"
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks start and end are times of day
+func (q *QuietHours) Validate() error {
+	if _, err := parseClock(q.Start); err != nil {
+		return err
+	}
+	_, err := parseClock(q.End)
+	return err
+}
+
+// Contains returns true if t is within quiet hours
+func (q *QuietHours) Contains(t time.Time) bool {
+	start, err1 := parseClock(q.Start)
+	end, err2 := parseClock(q.End)
+	if err1 != nil || err2 != nil || start == end {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	// over midnight
+	return now >= start || now < end
+}
+
+// EndAfter returns when the quiet hours t is in end
+func (q *QuietHours) EndAfter(t time.Time) time.Time {
+	end, _ := parseClock(q.End)
+	e := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, t.Location())
+	if !e.After(t) {
+		e = e.AddDate(0, 0, 1)
+	}
+	return e
+}
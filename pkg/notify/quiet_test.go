@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func at(clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", "2020-05-01 "+clock, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	tests := []struct {
+		start, end, at string
+		want           bool
+	}{
+		{"13:00", "15:00", "12:59", false},
+		{"13:00", "15:00", "13:00", true},
+		{"13:00", "15:00", "14:59", true},
+		{"13:00", "15:00", "15:00", false},
+		// over midnight
+		{"22:30", "07:00", "22:29", false},
+		{"22:30", "07:00", "22:30", true},
+		{"22:30", "07:00", "00:00", true},
+		{"22:30", "07:00", "06:59", true},
+		{"22:30", "07:00", "07:00", false},
+		{"22:30", "07:00", "12:00", false},
+		// empty or invalid
+		{"07:00", "07:00", "07:00", false},
+		{"7pm", "07:00", "23:00", false},
+	}
+	for _, tt := range tests {
+		q := &QuietHours{Start: tt.start, End: tt.end}
+		if got := q.Contains(at(tt.at)); got != tt.want {
+			t.Errorf("%s-%s contains %s = %v, want %v", tt.start, tt.end, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursEndAfter(t *testing.T) {
+	tests := []struct {
+		start, end, at string
+		want           time.Time
+	}{
+		{"13:00", "15:00", "14:00", at("15:00")},
+		{"22:30", "07:00", "23:00", at("07:00").AddDate(0, 0, 1)},
+		{"22:30", "07:00", "01:00", at("07:00")},
+	}
+	for _, tt := range tests {
+		q := &QuietHours{Start: tt.start, End: tt.end}
+		if got := q.EndAfter(at(tt.at)); !got.Equal(tt.want) {
+			t.Errorf("%s-%s at %s ends %v, want %v", tt.start, tt.end, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursValidate(t *testing.T) {
+	if err := (&QuietHours{Start: "22:30", End: "07:00"}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, q := range []QuietHours{{Start: "22:30"}, {Start: "25:00", End: "07:00"}, {Start: "10pm", End: "07:00"}} {
+		if err := q.Validate(); err == nil {
+			t.Errorf("%+v is valid", q)
+		}
+	}
+}
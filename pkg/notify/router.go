@@ -0,0 +1,269 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestEvent is the event of the message bundling those held back during
+// quiet hours
+const DigestEvent = "digest"
+
+// Config is which notifiers there are and what is sent where
+type Config struct {
+	// notifiers by name
+	Notifiers map[string]Spec
+	// names of the notifiers of each event, "default" for events not listed
+	Routes map[string][]string
+	// don't repeat a message with the same event and title within the
+	// window of its event, or "default"
+	RateLimits map[string]time.Duration
+}
+
+// routes returns the notifier names of event
+func (c *Config) routes(event string) []string {
+	if names, ok := c.Routes[event]; ok {
+		return names
+	}
+	return c.Routes["default"]
+}
+
+// Check returns an error if event isn't sent anywhere
+func (c *Config) Check(event string) error {
+	if len(c.routes(event)) == 0 {
+		return fmt.Errorf("no notifier for %s, add it or default to notify", event)
+	}
+	return nil
+}
+
+// Validate checks every notifier and route
+func (c *Config) Validate() error {
+	for name, spec := range c.Notifiers {
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("notifier %s:%v", name, err)
+		}
+	}
+	for event, names := range c.Routes {
+		for _, name := range names {
+			if _, ok := c.Notifiers[name]; !ok {
+				return fmt.Errorf("notify %s:unknown notifier %s", event, name)
+			}
+		}
+	}
+	for event, window := range c.RateLimits {
+		if window < 0 {
+			return fmt.Errorf("rate limit of %s can't be negative", event)
+		}
+	}
+	return nil
+}
+
+// channel is a notifier with its quiet hours state
+type channel struct {
+	name     string
+	spec     Spec
+	notifier Notifier
+	// held back for the digest
+	held  []Message
+	flush *time.Timer
+}
+
+// Router sends messages to the notifiers of their event, applying rate
+// limits and quiet hours. It keeps its state when its config is updated.
+type Router struct {
+	simulate bool
+
+	mu       sync.Mutex
+	cfg      Config
+	channels map[string]*channel
+	// when each event and title was last sent
+	sent map[string]time.Time
+}
+
+// NewRouter creates a router. When simulating, messages are logged instead
+// of sent and events without notifiers are logged too.
+func NewRouter(simulate bool) *Router {
+	return &Router{
+		simulate: simulate,
+		channels: make(map[string]*channel),
+		sent:     make(map[string]time.Time),
+	}
+}
+
+// Update switches to cfg, reopening the notifiers which changed
+func (r *Router) Update(cfg Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	for name, ch := range r.channels {
+		if spec, ok := cfg.Notifiers[name]; !ok || !reflect.DeepEqual(spec, ch.spec) {
+			// anything held for the digest is sent to the new notifier
+			ch.notifier, ch.spec = nil, spec
+			if !ok {
+				r.stop(ch)
+				delete(r.channels, name)
+			}
+		}
+	}
+}
+
+func (r *Router) channel(name string) (*channel, error) {
+	ch, ok := r.channels[name]
+	if !ok {
+		ch = &channel{name: name, spec: r.cfg.Notifiers[name]}
+		r.channels[name] = ch
+	}
+	if ch.notifier == nil {
+		if r.simulate {
+			ch.notifier = Log{}
+		} else {
+			n, err := Open(ch.spec)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %s:%v", name, err)
+			}
+			ch.notifier = n
+		}
+	}
+	return ch, nil
+}
+
+// Send sends m to the notifiers of its event, unless it's a repeat within
+// the rate limit. Notifiers in quiet hours hold it back for their digest or
+// drop it.
+func (r *Router) Send(m Message) error {
+	r.mu.Lock()
+	now := time.Now()
+	key := m.Event + "/" + m.Title
+	window, ok := r.cfg.RateLimits[m.Event]
+	if !ok {
+		window = r.cfg.RateLimits["default"]
+	}
+	if last, ok := r.sent[key]; ok && now.Sub(last) < window {
+		r.mu.Unlock()
+		log.Printf("Notification %s:%s suppressed, last sent %v ago\n", m.Event, m.Title, now.Sub(last).Round(time.Second))
+		return nil
+	}
+
+	names := r.cfg.routes(m.Event)
+	if len(names) == 0 && r.simulate {
+		r.mu.Unlock()
+		if err := Send(Log{}, m); err != nil {
+			return err
+		}
+		r.record(key, now)
+		return nil
+	}
+	var send Multi
+	var errs []string
+	held := false
+	for _, name := range names {
+		ch, err := r.channel(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if q := ch.spec.QuietHours; q != nil && q.Contains(now) && !(q.Urgent && m.Priority == PriorityHigh) {
+			if q.Digest {
+				r.hold(ch, m, q.EndAfter(now))
+				held = true
+				log.Printf("Notification %s:%s held for %s digest\n", m.Event, m.Title, name)
+			} else {
+				log.Printf("Notification %s:%s dropped, %s quiet hours\n", m.Event, m.Title, name)
+			}
+			continue
+		}
+		send = append(send, ch.notifier)
+	}
+	if len(names) == 0 {
+		errs = append(errs, r.cfg.Check(m.Event).Error())
+	}
+	r.mu.Unlock()
+
+	delivered := false
+	if len(send) > 0 {
+		if err := Send(send, m); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			delivered = true
+		}
+	}
+	// a failed message isn't rate limited, so that it can be retried
+	if delivered || held {
+		r.record(key, now)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// record remembers a message as sent at now, forgetting those sent longer
+// ago than any rate limit
+func (r *Router) record(key string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var longest time.Duration
+	for _, window := range r.cfg.RateLimits {
+		if window > longest {
+			longest = window
+		}
+	}
+	for k, last := range r.sent {
+		if now.Sub(last) >= longest {
+			delete(r.sent, k)
+		}
+	}
+	if longest > 0 {
+		r.sent[key] = now
+	}
+}
+
+// hold keeps m for the digest sent at end
+func (r *Router) hold(ch *channel, m Message, end time.Time) {
+	m.Body = fmt.Sprintf("%s %s", time.Now().Format("15:04"), m.Body)
+	ch.held = append(ch.held, m)
+	if ch.flush == nil {
+		ch.flush = time.AfterFunc(time.Until(end), func() { r.flush(ch.name) })
+	}
+}
+
+func (r *Router) stop(ch *channel) {
+	if ch.flush != nil {
+		ch.flush.Stop()
+	}
+}
+
+// flush sends the digest of the messages held by a notifier
+func (r *Router) flush(name string) {
+	r.mu.Lock()
+	ch, err := r.channel(name)
+	if err != nil {
+		r.mu.Unlock()
+		log.Printf("Digest failed:%v\n", err)
+		return
+	}
+	held := ch.held
+	ch.held, ch.flush = nil, nil
+	r.mu.Unlock()
+	if len(held) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, m := range held {
+		lines = append(lines, fmt.Sprintf("%s:%s", m.Title, m.Body))
+	}
+	digest := Message{
+		Event: DigestEvent,
+		Title: fmt.Sprintf("%d notifications during quiet hours", len(held)),
+		Body:  strings.Join(lines, "\n"),
+	}
+	if err := Send(ch.notifier, digest); err != nil {
+		log.Printf("Digest failed:%v\n", err)
+	}
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sent returns the titles of the webhook requests received so far
+func sent(requests <-chan request) []string {
+	var titles []string
+	for {
+		select {
+		case r := <-requests:
+			var m map[string]interface{}
+			json.Unmarshal([]byte(r.body), &m)
+			titles = append(titles, m["title"].(string))
+		default:
+			return titles
+		}
+	}
+}
+
+func TestRouterRateLimits(t *testing.T) {
+	srv, requests := standIn(http.StatusOK)
+	defer srv.Close()
+
+	r := NewRouter(false)
+	r.Update(Config{
+		Notifiers:  map[string]Spec{"hook": {Type: TypeWebhook, URL: srv.URL}},
+		Routes:     map[string][]string{"default": {"hook"}},
+		RateLimits: map[string]time.Duration{"default": time.Hour, "door_closed": 0},
+	})
+	for _, m := range []Message{
+		{Event: "door_open", Title: "Rear Door"},
+		{Event: "door_open", Title: "Rear Door"},   // repeat within the window
+		{Event: "door_open", Title: "Front Door"},  // another title
+		{Event: "battery_low", Title: "Rear Door"}, // another event
+		{Event: "door_closed", Title: "Rear Door"},
+		{Event: "door_closed", Title: "Rear Door"}, // not rate limited
+	} {
+		if err := r.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := strings.Join(sent(requests), ",")
+	if want := "Rear Door,Front Door,Rear Door,Rear Door,Rear Door"; got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+}
+
+func TestRouterRetriesFailed(t *testing.T) {
+	failing, _ := standIn(http.StatusInternalServerError)
+	defer failing.Close()
+	srv, requests := standIn(http.StatusOK)
+	defer srv.Close()
+
+	cfg := Config{
+		Notifiers:  map[string]Spec{"hook": {Type: TypeWebhook, URL: failing.URL}},
+		Routes:     map[string][]string{"default": {"hook"}},
+		RateLimits: map[string]time.Duration{"default": time.Hour},
+	}
+	r := NewRouter(false)
+	r.Update(cfg)
+	m := Message{Event: "door_open", Title: "Rear Door"}
+	if err := r.Send(m); err == nil {
+		t.Fatal("sent to a failing notifier")
+	}
+	// a failed message doesn't count towards the rate limit
+	cfg.Notifiers = map[string]Spec{"hook": {Type: TypeWebhook, URL: srv.URL}}
+	r.Update(cfg)
+	if err := r.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent(requests), ","); got != "Rear Door" {
+		t.Errorf("sent %q, want the retry", got)
+	}
+}
+
+func TestRouterForgetsExpired(t *testing.T) {
+	r := NewRouter(false)
+	r.Update(Config{RateLimits: map[string]time.Duration{"default": time.Hour, "door_open": 2 * time.Hour}})
+	now := time.Now()
+	r.sent["door_open/Rear Door"] = now.Add(-3 * time.Hour)
+	r.sent["door_open/Front Door"] = now.Add(-time.Hour)
+	r.record("battery_low/Rear Door", now)
+	if _, ok := r.sent["door_open/Rear Door"]; ok {
+		t.Error("expired message still remembered")
+	}
+	if len(r.sent) != 2 {
+		t.Errorf("remembered %v", r.sent)
+	}
+}
+
+func TestRouterQuietHours(t *testing.T) {
+	srv, requests := standIn(http.StatusOK)
+	defer srv.Close()
+
+	// quiet hours around now
+	now := time.Now()
+	quiet := func(digest bool) *QuietHours {
+		return &QuietHours{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04"),
+			Digest: digest, Urgent: true}
+	}
+	r := NewRouter(false)
+	r.Update(Config{
+		Notifiers: map[string]Spec{
+			"digest": {Type: TypeWebhook, URL: srv.URL + "/digest", QuietHours: quiet(true)},
+			"drop":   {Type: TypeWebhook, URL: srv.URL + "/drop", QuietHours: quiet(false)},
+		},
+		Routes: map[string][]string{"default": {"digest", "drop"}},
+	})
+	for _, m := range []Message{
+		{Event: "door_open", Title: "Rear Door", Body: "open"},
+		{Event: "battery_low", Title: "Front Door", Body: "low"},
+	} {
+		if err := r.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := sent(requests); len(got) != 0 {
+		t.Fatalf("sent %q during quiet hours", got)
+	}
+
+	// urgent ones still get through
+	if err := r.Send(Message{Event: "door_open_urgent", Title: "Urgent", Priority: PriorityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent(requests), ","); got != "Urgent,Urgent" {
+		t.Errorf("sent %s, want the urgent message to both", got)
+	}
+
+	r.flush("digest")
+	r.flush("drop")
+	select {
+	case req := <-requests:
+		if req.path != "/digest" {
+			t.Errorf("digest sent to %s", req.path)
+		}
+		var m map[string]interface{}
+		json.Unmarshal([]byte(req.body), &m)
+		body := m["message"].(string)
+		if m["event"] != DigestEvent || m["title"] != "2 notifications during quiet hours" ||
+			!strings.Contains(body, "Rear Door:") || !strings.Contains(body, " open\n") || !strings.HasSuffix(body, " low") {
+			t.Errorf("digest = %v", m)
+		}
+	default:
+		t.Fatal("no digest sent")
+	}
+	if got := sent(requests); len(got) != 0 {
+		t.Errorf("also sent %q", got)
+	}
+}
+
+func TestRouterUnrouted(t *testing.T) {
+	r := NewRouter(false)
+	r.Update(Config{Notifiers: map[string]Spec{"hook": {Type: TypeWebhook, URL: "http://127.0.0.1:1"}}})
+	if err := r.Send(Message{Event: "door_open", Title: "Rear Door"}); err == nil {
+		t.Error("message without notifier sent")
+	}
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP sends messages as plain text emails
+type SMTP struct {
+	Host string
+	// 587 if 0
+	Port int
+	// no authentication if empty
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify mails m to every recipient
+func (s *SMTP) Notify(ctx context.Context, m Message) error {
+	port := s.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	subject := m.Title
+	if m.Priority == PriorityHigh {
+		subject = "[URGENT] " + subject
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.From, strings.Join(s.To, ", "), subject, time.Now().Format(time.RFC1123Z), m.Body)
+
+	// smtp.SendMail can't be cancelled, give up waiting on it instead
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(s.Host, strconv.Itoa(port)), auth, s.From, s.To, []byte(msg))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp:%v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("smtp:%v", ctx.Err())
+	}
+}
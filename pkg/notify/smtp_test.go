@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mail is what the stand-in SMTP server received
+type mail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn accepts one mail on a local port, advertising PLAIN auth
+func smtpStandIn(t *testing.T) (net.Listener, <-chan mail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := make(chan mail, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var m mail
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO":
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+				m.auth = string(b)
+				tp.PrintfLine("235 accepted")
+			case "MAIL":
+				m.from = line
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				m.to = append(m.to, line)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, _ := tp.ReadDotBytes()
+				m.data = string(b)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				mails <- m
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return l, mails
+}
+
+func TestSMTP(t *testing.T) {
+	l, mails := smtpStandIn(t)
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	s := &SMTP{Host: "127.0.0.1", Port: p, Username: "pi", Password: "secret",
+		From: "pi@example.com", To: []string{"me@example.com", "wife@example.com"}}
+	if err := s.Notify(context.Background(), urgent); err != nil {
+		t.Fatal(err)
+	}
+	var m mail
+	select {
+	case m = <-mails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+	if m.auth != "\x00pi\x00secret" {
+		t.Errorf("auth = %q", m.auth)
+	}
+	if m.from != "MAIL FROM:<pi@example.com>" {
+		t.Errorf("from = %q", m.from)
+	}
+	if len(m.to) != 2 || m.to[0] != "RCPT TO:<me@example.com>" || m.to[1] != "RCPT TO:<wife@example.com>" {
+		t.Errorf("to = %q", m.to)
+	}
+	for _, want := range []string{
+		"From: pi@example.com\n",
+		"To: me@example.com, wife@example.com\n",
+		"Subject: [URGENT] Rear Door Warning\n",
+		"\n\nStill open\n",
+	} {
+		if !strings.Contains(m.data, want) {
+			t.Errorf("mail doesn't contain %q:\n%s", want, m.data)
+		}
+	}
+}
+
+func TestSMTPCancelled(t *testing.T) {
+	// accepts the connection but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s := &SMTP{Host: "127.0.0.1", Port: p, From: "pi@example.com", To: []string{"me@example.com"}}
+	if err := s.Notify(ctx, doorOpen); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("error = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,52 @@
+package sensors
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/flock"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// BH1750 is a BH1750 ambient light sensor on the I2C bus
+type BH1750 struct {
+	name   string
+	driver *i2c.BH1750Driver
+	lock   *flock.Flock
+}
+
+// NewBH1750 creates a BH1750 sensor on the given I2C bus and address. Access
+// to the sensor is serialised with other processes through the lock file.
+func NewBH1750(name string, conn i2c.Connector, bus, address int, lockFile string) *BH1750 {
+	return &BH1750{
+		name:   name,
+		driver: i2c.NewBH1750Driver(conn, i2c.WithBus(bus), i2c.WithAddress(address)),
+		lock:   flock.New(lockFile),
+	}
+}
+
+// Name returns the sensor ID
+func (b *BH1750) Name() string {
+	return b.name
+}
+
+// Device returns the gobot device to be added to a robot
+func (b *BH1750) Device() gobot.Device {
+	return b.driver
+}
+
+// Read returns lux
+func (b *BH1750) Read(ctx context.Context) (Readings, error) {
+	var lux int
+	err := withLock(ctx, b.lock, func() (err error) {
+		lux, err = b.driver.Lux()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReadings(b.name, time.Now(), map[Quantity]float64{
+		Lux: float64(lux),
+	}), nil
+}
@@ -0,0 +1,60 @@
+package sensors
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/flock"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// BME280 is a BME280 temperature, humidity and pressure sensor on the I2C bus
+type BME280 struct {
+	name   string
+	driver *i2c.BME280Driver
+	lock   *flock.Flock
+}
+
+// NewBME280 creates a BME280 sensor on the given I2C bus and address. Access
+// to the sensor is serialised with other processes through the lock file.
+func NewBME280(name string, conn i2c.Connector, bus, address int, lockFile string) *BME280 {
+	return &BME280{
+		name:   name,
+		driver: i2c.NewBME280Driver(conn, i2c.WithBus(bus), i2c.WithAddress(address)),
+		lock:   flock.New(lockFile),
+	}
+}
+
+// Name returns the sensor ID
+func (b *BME280) Name() string {
+	return b.name
+}
+
+// Device returns the gobot device to be added to a robot
+func (b *BME280) Device() gobot.Device {
+	return b.driver
+}
+
+// Read returns temperature, humidity and pressure
+func (b *BME280) Read(ctx context.Context) (Readings, error) {
+	var temperature, humidity, pressure float32
+	err := withLock(ctx, b.lock, func() (err error) {
+		if temperature, err = b.driver.Temperature(); err != nil {
+			return err
+		}
+		if humidity, err = b.driver.Humidity(); err != nil {
+			return err
+		}
+		pressure, err = b.driver.Pressure()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReadings(b.name, time.Now(), map[Quantity]float64{
+		Temperature: float64(temperature),
+		Humidity:    float64(humidity),
+		Pressure:    float64(pressure) / 100, // Pa to hPa
+	}), nil
+}
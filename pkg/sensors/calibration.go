@@ -0,0 +1,55 @@
+package sensors
+
+import "context"
+
+// Correction is a linear correction applied to a measured value:
+// corrected = measured*Gain + Offset. A zero Gain is treated as 1.
+type Correction struct {
+	Offset float64 `yaml:"offset"`
+	Gain   float64 `yaml:"gain"`
+}
+
+// Apply returns the corrected value
+func (c Correction) Apply(v float64) float64 {
+	gain := c.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return v*gain + c.Offset
+}
+
+// Calibration holds corrections per sensor ID and quantity, in YAML e.g.
+//
+//	dht22:
+//	  temperature: {offset: -1.2}
+//	  humidity: {gain: 1.05}
+type Calibration map[string]map[Quantity]Correction
+
+// Apply wraps the sensor so its readings are corrected, if there is any
+// correction for it
+func (c Calibration) Apply(sensor Sensor) Sensor {
+	corrections, ok := c[sensor.Name()]
+	if !ok || len(corrections) == 0 {
+		return sensor
+	}
+	return &calibrated{Sensor: sensor, corrections: corrections}
+}
+
+type calibrated struct {
+	Sensor
+	corrections map[Quantity]Correction
+}
+
+// Read returns corrected readings, Raw still holds the measured value
+func (c *calibrated) Read(ctx context.Context) (Readings, error) {
+	readings, err := c.Sensor.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range readings {
+		if corr, ok := c.corrections[r.Quantity]; ok {
+			readings[i].Value = corr.Apply(r.Value)
+		}
+	}
+	return readings, nil
+}
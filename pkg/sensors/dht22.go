@@ -0,0 +1,52 @@
+package sensors
+
+import (
+	"context"
+	"time"
+
+	logger "github.com/d2r2/go-logger"
+	"github.com/gofrs/flock"
+	"github.com/starryalley/go-dht"
+)
+
+// DHT22 is a DHT22 temperature and humidity sensor connected to a GPIO pin
+type DHT22 struct {
+	name  string
+	gpio  int
+	retry int
+	lock  *flock.Flock
+}
+
+// NewDHT22 creates a DHT22 sensor on the given GPIO number. Access to the
+// sensor is serialised with other processes through the lock file.
+func NewDHT22(name string, gpio int, lockFile string) *DHT22 {
+	logger.ChangePackageLogLevel("dht", logger.ErrorLevel)
+	return &DHT22{
+		name:  name,
+		gpio:  gpio,
+		retry: 30,
+		lock:  flock.New(lockFile),
+	}
+}
+
+// Name returns the sensor ID
+func (d *DHT22) Name() string {
+	return d.name
+}
+
+// Read returns temperature and humidity from DHT sensor
+func (d *DHT22) Read(ctx context.Context) (Readings, error) {
+	var temperature, humidity float32
+	err := withLock(ctx, d.lock, func() (err error) {
+		temperature, humidity, _, err =
+			dht.ReadDHTxxWithRetry(dht.DHT22, d.gpio, false, d.retry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReadings(d.name, time.Now(), map[Quantity]float64{
+		Temperature: float64(temperature),
+		Humidity:    float64(humidity),
+	}), nil
+}
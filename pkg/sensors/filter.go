@@ -0,0 +1,230 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Smoothing methods applied to accepted samples
+const (
+	SmoothNone   = ""
+	SmoothMedian = "median"
+	SmoothEMA    = "ema"
+)
+
+// after this many rate-of-change rejections in a row the new level is
+// accepted, otherwise a real step change would be rejected forever
+const maxConsecutiveRejects = 3
+
+// Bounds is the plausible range of a quantity
+type Bounds struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// FilterConfig configures outlier rejection and smoothing, in YAML e.g.
+//
+//	bounds: {temperature: {min: -10, max: 50}}
+//	max_rate: {temperature: 0.05}
+//	smoothing: ema
+//	alpha: 0.3
+type FilterConfig struct {
+	// samples outside these bounds are rejected
+	Bounds map[Quantity]Bounds `yaml:"bounds"`
+	// samples changing faster than this many units per second are rejected
+	MaxRate map[Quantity]float64 `yaml:"max_rate"`
+	// Smoothing is one of SmoothNone, SmoothMedian or SmoothEMA
+	Smoothing string `yaml:"smoothing"`
+	// number of accepted samples in the median window
+	Window int `yaml:"window"`
+	// EMA smoothing factor, 0 < Alpha <= 1
+	Alpha float64 `yaml:"alpha"`
+}
+
+// Validate checks the bounds, rates and smoothing settings
+func (c FilterConfig) Validate() error {
+	for q, b := range c.Bounds {
+		if b.Min > b.Max {
+			return fmt.Errorf("%s bounds:min %v above max %v", q, b.Min, b.Max)
+		}
+	}
+	for q, rate := range c.MaxRate {
+		if rate <= 0 {
+			return fmt.Errorf("%s max_rate must be positive", q)
+		}
+	}
+	switch c.Smoothing {
+	case SmoothNone:
+	case SmoothMedian:
+		if c.Window < 1 {
+			return errors.New("median window must be at least 1")
+		}
+	case SmoothEMA:
+		if c.Alpha <= 0 || c.Alpha > 1 {
+			return fmt.Errorf("ema alpha %v must be in (0, 1]", c.Alpha)
+		}
+	default:
+		return fmt.Errorf("unknown smoothing:%s", c.Smoothing)
+	}
+	return nil
+}
+
+// Filters holds the filter of each sensor ID, in YAML e.g.
+//
+//	dht22: {smoothing: median, window: 9}
+//	bme: {smoothing: ema, alpha: 0.3}
+//
+// A sensor without one is filtered with DHT22Filter if it's a DHT22, others
+// aren't filtered. An empty entry turns off filtering for the sensor.
+type Filters map[string]FilterConfig
+
+// Apply wraps the sensor described by spec in its filter, if it has any
+func (f Filters) Apply(sensor Sensor, spec Spec) Sensor {
+	cfg, ok := f[spec.Name]
+	if !ok {
+		if spec.Kind != KindDHT22 {
+			return sensor
+		}
+		cfg = DHT22Filter
+	}
+	if len(cfg.Bounds) == 0 && len(cfg.MaxRate) == 0 && cfg.Smoothing == SmoothNone {
+		return sensor
+	}
+	return NewFiltered(sensor, cfg)
+}
+
+// DHT22Filter rejects the garbage spikes DHT22 is known to return, the
+// filter of DHT22 sensors without one in Filters
+var DHT22Filter = FilterConfig{
+	Bounds: map[Quantity]Bounds{
+		Temperature: {Min: -10, Max: 50},
+		Humidity:    {Min: 0, Max: 100},
+	},
+	MaxRate: map[Quantity]float64{
+		Temperature: 0.05, // 3°C per minute
+		Humidity:    0.5,
+	},
+	Smoothing: SmoothMedian,
+	Window:    5,
+}
+
+type filterState struct {
+	window   []float64
+	ema      float64
+	last     float64
+	lastTime time.Time
+	rejects  int
+}
+
+// Filtered wraps a sensor and filters its readings. Value of each reading is
+// replaced by the filtered value; rejected samples are flagged with Rejected
+// and don't affect the filtered value.
+type Filtered struct {
+	Sensor
+	cfg FilterConfig
+
+	mu     sync.Mutex
+	states map[Quantity]*filterState
+}
+
+// NewFiltered creates a filtering layer on top of sensor
+func NewFiltered(sensor Sensor, cfg FilterConfig) *Filtered {
+	return &Filtered{
+		Sensor: sensor,
+		cfg:    cfg,
+		states: make(map[Quantity]*filterState),
+	}
+}
+
+// Read reads the underlying sensor and filters the readings
+func (f *Filtered) Read(ctx context.Context) (Readings, error) {
+	readings, err := f.Sensor.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range readings {
+		f.filter(&readings[i])
+	}
+	return readings, nil
+}
+
+func (f *Filtered) filter(r *Reading) {
+	st, ok := f.states[r.Quantity]
+	if !ok {
+		st = &filterState{}
+		f.states[r.Quantity] = st
+	}
+	v := r.Value
+
+	if b, ok := f.cfg.Bounds[r.Quantity]; ok && (v < b.Min || v > b.Max) {
+		f.reject(st, r, "out of bounds")
+		return
+	}
+	if rate, ok := f.cfg.MaxRate[r.Quantity]; ok && !st.lastTime.IsZero() {
+		dt := r.Time.Sub(st.lastTime).Seconds()
+		if dt > 0 && math.Abs(v-st.last)/dt > rate {
+			if st.rejects < maxConsecutiveRejects {
+				st.rejects++
+				f.reject(st, r, "changing too fast")
+				return
+			}
+			// the value really moved, start over from here
+			log.Printf("%s %s settled at %.01f%s\n", r.Sensor, r.Quantity, v, r.Unit())
+			st.window = nil
+			st.lastTime = time.Time{}
+		}
+	}
+	st.rejects = 0
+	r.Value = f.smooth(st, v)
+	st.last, st.lastTime = v, r.Time
+}
+
+func (f *Filtered) reject(st *filterState, r *Reading, reason string) {
+	log.Printf("rejected %s %s:%.01f%s (%s)\n", r.Sensor, r.Quantity, r.Value, r.Unit(), reason)
+	r.Rejected = true
+	// keep reporting the last filtered value
+	r.Value = st.ema
+	if f.cfg.Smoothing != SmoothEMA {
+		r.Value = st.last
+		if len(st.window) > 0 {
+			r.Value = median(st.window)
+		}
+	}
+}
+
+func (f *Filtered) smooth(st *filterState, v float64) float64 {
+	switch f.cfg.Smoothing {
+	case SmoothMedian:
+		st.window = append(st.window, v)
+		if f.cfg.Window > 0 && len(st.window) > f.cfg.Window {
+			st.window = st.window[len(st.window)-f.cfg.Window:]
+		}
+		return median(st.window)
+	case SmoothEMA:
+		if st.lastTime.IsZero() {
+			st.ema = v
+		} else {
+			st.ema += f.cfg.Alpha * (v - st.ema)
+		}
+		return st.ema
+	}
+	return v
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,149 @@
+package sensors
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// scripted returns one value per read, read 10 seconds apart
+type scripted struct {
+	values []float64
+	n      int
+}
+
+func (s *scripted) Name() string {
+	return "scripted"
+}
+
+func (s *scripted) Read(ctx context.Context) (Readings, error) {
+	v := s.values[s.n]
+	t := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(s.n) * 10 * time.Second)
+	s.n++
+	return Readings{{Sensor: s.Name(), Quantity: Temperature, Value: v, Raw: v, Time: t}}, nil
+}
+
+func TestFiltered(t *testing.T) {
+	bounds := map[Quantity]Bounds{Temperature: {Min: -10, Max: 50}}
+	rate := map[Quantity]float64{Temperature: 0.05} // 0.5° between reads
+	tests := []struct {
+		name     string
+		cfg      FilterConfig
+		in       []float64
+		want     []float64
+		rejected []bool
+	}{
+		{
+			name:     "out of bounds",
+			cfg:      FilterConfig{Bounds: bounds},
+			in:       []float64{20, 80, -20, 21},
+			want:     []float64{20, 20, 20, 21},
+			rejected: []bool{false, true, true, false},
+		},
+		{
+			name:     "too fast",
+			cfg:      FilterConfig{MaxRate: rate},
+			in:       []float64{20, 25, 20.3},
+			want:     []float64{20, 20, 20.3},
+			rejected: []bool{false, true, false},
+		},
+		{
+			name:     "step change settles",
+			cfg:      FilterConfig{MaxRate: rate},
+			in:       []float64{20, 25, 25, 25, 25, 25.2},
+			want:     []float64{20, 20, 20, 20, 25, 25.2},
+			rejected: []bool{false, true, true, true, false, false},
+		},
+		{
+			name: "median",
+			cfg:  FilterConfig{Smoothing: SmoothMedian, Window: 3},
+			in:   []float64{20, 22, 21, 30, 23},
+			want: []float64{20, 21, 21, 22, 23},
+		},
+		{
+			name:     "median holds on reject",
+			cfg:      FilterConfig{Bounds: bounds, Smoothing: SmoothMedian, Window: 3},
+			in:       []float64{20, 22, 99},
+			want:     []float64{20, 21, 21},
+			rejected: []bool{false, false, true},
+		},
+		{
+			name:     "ema",
+			cfg:      FilterConfig{Bounds: bounds, Smoothing: SmoothEMA, Alpha: 0.5},
+			in:       []float64{20, 22, 24, 99},
+			want:     []float64{20, 21, 22.5, 22.5},
+			rejected: []bool{false, false, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFiltered(&scripted{values: tt.in}, tt.cfg)
+			for i, in := range tt.in {
+				readings, err := f.Read(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := readings[0]
+				rejected := tt.rejected != nil && tt.rejected[i]
+				if r.Value != tt.want[i] || r.Rejected != rejected || r.Raw != in {
+					t.Errorf("read %d of %v = %v rejected:%v raw:%v, want %v rejected:%v",
+						i, in, r.Value, r.Rejected, r.Raw, tt.want[i], rejected)
+				}
+				if _, err := readings.Value(Temperature); (err != nil) != rejected {
+					t.Errorf("read %d:Value error %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  FilterConfig
+		ok   bool
+	}{
+		{"none", FilterConfig{}, true},
+		{"dht22", DHT22Filter, true},
+		{"bounds reversed", FilterConfig{Bounds: map[Quantity]Bounds{Temperature: {Min: 50, Max: -10}}}, false},
+		{"zero rate", FilterConfig{MaxRate: map[Quantity]float64{Humidity: 0}}, false},
+		{"median without window", FilterConfig{Smoothing: SmoothMedian}, false},
+		{"ema", FilterConfig{Smoothing: SmoothEMA, Alpha: 1}, true},
+		{"ema alpha too big", FilterConfig{Smoothing: SmoothEMA, Alpha: 1.5}, false},
+		{"ema without alpha", FilterConfig{Smoothing: SmoothEMA}, false},
+		{"unknown smoothing", FilterConfig{Smoothing: "mean", Window: 3}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s:Validate() = %v, want ok:%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestFiltersApply(t *testing.T) {
+	ema := FilterConfig{Smoothing: SmoothEMA, Alpha: 0.5}
+	filters := Filters{"dht22": ema, "off": {}, "lux": DHT22Filter}
+	tests := []struct {
+		spec Spec
+		// the filter applied, nil if none
+		want *FilterConfig
+	}{
+		{Spec{Name: "dht22", Kind: KindDHT22}, &ema},
+		{Spec{Name: "garage", Kind: KindDHT22}, &DHT22Filter},
+		{Spec{Name: "off", Kind: KindDHT22}, nil},
+		{Spec{Name: "bme", Kind: KindBME280}, nil},
+		{Spec{Name: "lux", Kind: KindTSL2561}, &DHT22Filter},
+	}
+	for _, tt := range tests {
+		sensor := &scripted{}
+		f, filtered := filters.Apply(sensor, tt.spec).(*Filtered)
+		switch {
+		case tt.want == nil && filtered:
+			t.Errorf("%s filtered with %+v", tt.spec.Name, f.cfg)
+		case tt.want != nil && !filtered:
+			t.Errorf("%s not filtered", tt.spec.Name)
+		case tt.want != nil && (f.cfg.Smoothing != tt.want.Smoothing || f.cfg.Alpha != tt.want.Alpha || f.Sensor != sensor):
+			t.Errorf("%s filtered with %+v, want %+v", tt.spec.Name, f.cfg, *tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package sensors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// backoff between lock attempts
+const (
+	minLockBackoff = 10 * time.Millisecond
+	maxLockBackoff = time.Second
+)
+
+// DefaultReadTimeout is how long a command should wait for a sensor,
+// including waiting for other processes to release it
+const DefaultReadTimeout = time.Minute
+
+// LockTimeoutError is returned when a lock file can't be acquired before the
+// context is done
+type LockTimeoutError struct {
+	Path   string
+	Waited time.Duration
+	Err    error
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("gave up locking %s after %v:%v", e.Path, e.Waited.Round(time.Millisecond), e.Err)
+}
+
+// AcquireLock blocks until the file lock is held or ctx is done, backing off
+// exponentially between attempts. It returns how long it waited. When ctx is
+// done first the error is a *LockTimeoutError.
+func AcquireLock(ctx context.Context, lock *flock.Flock) (time.Duration, error) {
+	start := time.Now()
+	backoff := minLockBackoff
+	for {
+		locked, err := lock.TryLock()
+		if err != nil {
+			return time.Since(start), err
+		}
+		if locked {
+			return time.Since(start), nil
+		}
+		select {
+		case <-ctx.Done():
+			waited := time.Since(start)
+			return waited, &LockTimeoutError{Path: lock.Path(), Waited: waited, Err: ctx.Err()}
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxLockBackoff {
+			backoff = maxLockBackoff
+		}
+	}
+}
+
+// withLock runs fn while holding the lock
+func withLock(ctx context.Context, lock *flock.Flock, fn func() error) error {
+	waited, err := AcquireLock(ctx, lock)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if waited > maxLockBackoff {
+		log.Printf("waited %v for %s\n", waited.Round(time.Millisecond), lock.Path())
+	}
+	return fn()
+}
@@ -0,0 +1,188 @@
+package sensors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// sensor kinds supported by Open
+const (
+	KindDHT22   = "dht22"
+	KindTSL2561 = "tsl2561"
+	KindBME280  = "bme280"
+	KindSHT31   = "sht31"
+	KindBH1750  = "bh1750"
+)
+
+// default GPIO number for DHT22
+const defaultDHT22Pin = 4
+
+// default I2C address of each kind
+var defaultAddresses = map[string]int{
+	KindTSL2561: 0x39,
+	KindBME280:  0x77,
+	KindSHT31:   0x44,
+	KindBH1750:  0x23,
+}
+
+// Spec describes a sensor and where it's connected
+type Spec struct {
+	Name    string `yaml:"name"`    // sensor ID, the kind if empty
+	Kind    string `yaml:"kind"`    // one of the Kind constants
+	Pin     int    `yaml:"pin"`     // GPIO (BCM) number for DHT22
+	Bus     int    `yaml:"bus"`     // I2C bus
+	Address int    `yaml:"address"` // I2C address
+}
+
+// IsI2C returns true if the sensor is on the I2C bus
+func (s Spec) IsI2C() bool {
+	_, ok := defaultAddresses[s.Kind]
+	return ok
+}
+
+// WithDefaults returns the spec with the name, pin and address filled in
+// with the kind's defaults where they're not set
+func (s Spec) WithDefaults() Spec {
+	if s.Name == "" {
+		s.Name = s.Kind
+	}
+	if s.Kind == KindDHT22 && s.Pin == 0 {
+		s.Pin = defaultDHT22Pin
+	}
+	if s.IsI2C() && s.Address == 0 {
+		s.Address = defaultAddresses[s.Kind]
+	}
+	return s
+}
+
+// Validate checks the kind is known and only the relevant connection is set
+func (s Spec) Validate() error {
+	switch {
+	case s.Kind == KindDHT22:
+		if s.Bus != 0 || s.Address != 0 {
+			return fmt.Errorf("sensor %s:dht22 is on a GPIO pin, not I2C", s.Name)
+		}
+	case s.IsI2C():
+		if s.Pin != 0 {
+			return fmt.Errorf("sensor %s:%s is on I2C, not a GPIO pin", s.Name, s.Kind)
+		}
+		if s.Address < 0x03 || s.Address > 0x77 {
+			return fmt.Errorf("sensor %s:invalid I2C address %#x", s.Name, s.Address)
+		}
+	default:
+		return fmt.Errorf("sensor %s:unknown kind %s", s.Name, s.Kind)
+	}
+	return nil
+}
+
+// ParseSpec parses a sensor description in the form "dht22[@pin]" or
+// "kind[@bus[:address]]" for I2C sensors, e.g. "bme280@1:0x76". Omitted
+// values take the kind's defaults.
+func ParseSpec(s string) (Spec, error) {
+	parts := strings.SplitN(s, "@", 2)
+	spec := Spec{Kind: parts[0]}
+	var where []string
+	if len(parts) == 2 {
+		where = strings.Split(parts[1], ":")
+	}
+	values := make([]int, len(where))
+	for i, w := range where {
+		v, err := strconv.ParseInt(w, 0, 0)
+		if err != nil {
+			return spec, fmt.Errorf("invalid sensor %s:%v", s, err)
+		}
+		values[i] = int(v)
+	}
+
+	switch {
+	case spec.Kind == KindDHT22:
+		if len(values) > 1 {
+			return spec, fmt.Errorf("invalid sensor %s:expecting dht22@pin", s)
+		}
+		if len(values) == 1 {
+			spec.Pin = values[0]
+		}
+	case spec.IsI2C():
+		if len(values) > 2 {
+			return spec, fmt.Errorf("invalid sensor %s:expecting %s@bus:address", s, spec.Kind)
+		}
+		if len(values) > 0 {
+			spec.Bus = values[0]
+		}
+		if len(values) > 1 {
+			spec.Address = values[1]
+		}
+	default:
+		return spec, fmt.Errorf("unknown sensor kind:%s", spec.Kind)
+	}
+	spec = spec.WithDefaults()
+	return spec, spec.Validate()
+}
+
+func (s Spec) lockFile() string {
+	return fmt.Sprintf("/var/lock/%s.lock", s.Kind)
+}
+
+// Open creates the sensor described by spec. I2C sensors are connected through conn.
+func Open(spec Spec, conn i2c.Connector) (Sensor, error) {
+	switch spec.Kind {
+	case KindDHT22:
+		return NewDHT22(spec.Name, spec.Pin, spec.lockFile()), nil
+	case KindTSL2561:
+		return NewTSL2561(spec.Name, conn, spec.Bus, spec.Address, spec.lockFile()), nil
+	case KindBME280:
+		return NewBME280(spec.Name, conn, spec.Bus, spec.Address, spec.lockFile()), nil
+	case KindSHT31:
+		return NewSHT31(spec.Name, conn, spec.Bus, spec.Address, spec.lockFile()), nil
+	case KindBH1750:
+		return NewBH1750(spec.Name, conn, spec.Bus, spec.Address, spec.lockFile()), nil
+	}
+	return nil, fmt.Errorf("unknown sensor kind:%s", spec.Kind)
+}
+
+// OpenSimulated creates a simulated sensor measuring what the sensor described by spec measures
+func OpenSimulated(spec Spec) (Sensor, error) {
+	switch spec.Kind {
+	case KindDHT22, KindSHT31:
+		return NewSimulatedDHT22(spec.Name), nil
+	case KindTSL2561:
+		return NewSimulatedTSL2561(spec.Name), nil
+	case KindBME280:
+		return NewSimulated(spec.Name, map[Quantity]Walk{
+			Temperature: {Start: 20, Min: 5, Max: 35, Step: 0.3},
+			Humidity:    {Start: 55, Min: 20, Max: 95, Step: 1},
+			Pressure:    {Start: 1013, Min: 980, Max: 1040, Step: 0.5},
+		}), nil
+	case KindBH1750:
+		return NewSimulated(spec.Name, map[Quantity]Walk{
+			Lux: {Start: 60, Min: 0, Max: 400, Step: 20},
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown sensor kind:%s", spec.Kind)
+}
+
+// Setup opens the sensor described by spec, or a simulated one, and applies
+// calibration and the sensor's outlier filter. The returned device is non-nil
+// if it has to be added to the robot.
+func Setup(spec Spec, conn i2c.Connector, simulate bool, calibration Calibration, filters Filters) (Sensor, gobot.Device, error) {
+	var sensor Sensor
+	var device gobot.Device
+	var err error
+	if simulate {
+		sensor, err = OpenSimulated(spec)
+	} else {
+		sensor, err = Open(spec, conn)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if ds, ok := sensor.(DeviceSensor); ok {
+		device = ds.Device()
+	}
+	sensor = calibration.Apply(sensor)
+	return filters.Apply(sensor, spec), device, nil
+}
@@ -1,36 +1,132 @@
 package sensors
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
 
-	logger "github.com/d2r2/go-logger"
-	"github.com/gofrs/flock"
-	"github.com/starryalley/go-dht"
+	"gobot.io/x/gobot"
+
+	"github.com/starryalley/smart_home/pkg/events"
+)
+
+// Quantity is a physical quantity measured by a sensor
+type Quantity string
+
+// quantities known to sensors in this package
+const (
+	Temperature Quantity = "temperature" // air temperature in °C
+	Humidity    Quantity = "humidity"    // relative humidity in %
+	Pressure    Quantity = "pressure"    // air pressure in hPa
+	Lux         Quantity = "lux"         // illuminance in lx
+	Broadband   Quantity = "broadband"   // raw broadband (visible+IR) channel count
+	Infrared    Quantity = "infrared"    // raw IR channel count
+
+	// derived from temperature and humidity, see package comfort
+	DewPoint         Quantity = "dew_point"         // dew point in °C
+	HeatIndex        Quantity = "heat_index"        // apparent temperature in °C
+	AbsoluteHumidity Quantity = "absolute_humidity" // water vapour density in g/m³
 )
 
-// GPIO number for DHT temperature sensor
-const gpioTemp = 4
-
-// GetTempHum returns temperature and humidity from DHT sensor
-func GetTempHum(lock *flock.Flock) (float32, float32, error) {
-	logger.ChangePackageLogLevel("dht", logger.ErrorLevel)
-	var temperature, humidity float32
-	for {
-		locked, err := lock.TryLock()
-		if err != nil {
-			log.Printf("unable to lock for DHT22:%v\n", err)
-			return 0, 0, err
+// units for each known quantity
+var units = map[Quantity]string{
+	Temperature: "°C",
+	Humidity:    "%",
+	Pressure:    "hPa",
+	Lux:         "lx",
+	Broadband:   "",
+	Infrared:    "",
+
+	DewPoint:         "°C",
+	HeatIndex:        "°C",
+	AbsoluteHumidity: "g/m³",
+}
+
+// Unit returns the unit a quantity is reported in
+func (q Quantity) Unit() string {
+	return units[q]
+}
+
+// Reading is a single measured value from a sensor. Raw is the value
+// measured by the hardware before calibration and filtering, Rejected is set
+// if a filter considered it implausible.
+type Reading struct {
+	Sensor   string    `json:"sensor"`
+	Quantity Quantity  `json:"quantity"`
+	Value    float64   `json:"value"`
+	Raw      float64   `json:"raw"`
+	Rejected bool      `json:"rejected,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Unit returns the unit of this reading
+func (r Reading) Unit() string {
+	return r.Quantity.Unit()
+}
+
+func (r Reading) String() string {
+	return fmt.Sprintf("%s:%.01f%s", r.Quantity, r.Value, r.Unit())
+}
+
+// Readings is the result of reading a sensor once
+type Readings []Reading
+
+// Get returns the reading of the given quantity
+func (rs Readings) Get(q Quantity) (Reading, bool) {
+	for _, r := range rs {
+		if r.Quantity == q {
+			return r, true
 		}
-		if locked {
-			temperature, humidity, _, err =
-				dht.ReadDHTxxWithRetry(dht.DHT22, gpioTemp, false, 30)
-			if err != nil {
-				lock.Unlock()
-				return 0, 0, err
-			}
-			lock.Unlock()
-			break
+	}
+	return Reading{}, false
+}
+
+// Value returns the value of the given quantity, or an error if the quantity
+// isn't measured or the reading was rejected by a filter
+func (rs Readings) Value(q Quantity) (float64, error) {
+	r, ok := rs.Get(q)
+	if !ok {
+		return 0, fmt.Errorf("no %s reading", q)
+	}
+	if r.Rejected {
+		return 0, fmt.Errorf("%s reading %.01f%s rejected", q, r.Raw, r.Unit())
+	}
+	return r.Value, nil
+}
+
+// Publish sends the readings which weren't rejected to the event bus
+func (rs Readings) Publish() {
+	for _, r := range rs {
+		if r.Rejected {
+			continue
 		}
+		e := events.New(r.Sensor, events.Reading, "", strconv.FormatFloat(r.Value, 'f', -1, 64)).
+			With("quantity", string(r.Quantity)).With("unit", r.Unit())
+		e.Time = r.Time
+		events.Publish(e)
 	}
-	return temperature, humidity, nil
+}
+
+// Sensor is a piece of hardware which measures one or more quantities
+type Sensor interface {
+	// Name returns the sensor ID
+	Name() string
+	// Read measures all quantities supported by this sensor, giving up when ctx is done
+	Read(ctx context.Context) (Readings, error)
+}
+
+func newReadings(sensor string, t time.Time, values map[Quantity]float64) Readings {
+	rs := make(Readings, 0, len(values))
+	for q, v := range values {
+		rs = append(rs, Reading{Sensor: sensor, Quantity: q, Value: v, Raw: v, Time: t})
+	}
+	return rs
+}
+
+// DeviceSensor is a sensor driven by a gobot driver, which has to be added to
+// the robot's device list so it is started together with the robot
+type DeviceSensor interface {
+	Sensor
+	Device() gobot.Device
 }
@@ -0,0 +1,53 @@
+package sensors
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/flock"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// SHT31 is a SHT31 temperature and humidity sensor on the I2C bus
+type SHT31 struct {
+	name   string
+	driver *i2c.SHT3xDriver
+	lock   *flock.Flock
+}
+
+// NewSHT31 creates a SHT31 sensor on the given I2C bus and address. Access
+// to the sensor is serialised with other processes through the lock file.
+func NewSHT31(name string, conn i2c.Connector, bus, address int, lockFile string) *SHT31 {
+	return &SHT31{
+		name:   name,
+		driver: i2c.NewSHT3xDriver(conn, i2c.WithBus(bus), i2c.WithAddress(address)),
+		lock:   flock.New(lockFile),
+	}
+}
+
+// Name returns the sensor ID
+func (s *SHT31) Name() string {
+	return s.name
+}
+
+// Device returns the gobot device to be added to a robot
+func (s *SHT31) Device() gobot.Device {
+	return s.driver
+}
+
+// Read returns temperature and humidity
+func (s *SHT31) Read(ctx context.Context) (Readings, error) {
+	var temperature, humidity float32
+	err := withLock(ctx, s.lock, func() (err error) {
+		temperature, humidity, err = s.driver.Sample()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReadings(s.name, time.Now(), map[Quantity]float64{
+		Temperature: float64(temperature),
+		Humidity:    float64(humidity),
+	}), nil
+}
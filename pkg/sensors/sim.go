@@ -0,0 +1,95 @@
+package sensors
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Walk describes how a simulated quantity moves between reads. If Script is
+// set the values are replayed in order (and repeated), otherwise the value
+// does a random walk of at most Step per read, bounded by Min and Max. With
+// probability Spikes a read returns garbage far outside Min and Max instead.
+type Walk struct {
+	Start, Min, Max, Step float64
+	Script                []float64
+	Spikes                float64
+}
+
+// Simulated is a fake sensor producing scripted or random-walk values
+type Simulated struct {
+	name  string
+	walks map[Quantity]Walk
+
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	values map[Quantity]float64
+	step   int
+}
+
+// NewSimulated creates a simulated sensor measuring the given quantities
+func NewSimulated(name string, walks map[Quantity]Walk) *Simulated {
+	s := &Simulated{
+		name:   name,
+		walks:  walks,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		values: make(map[Quantity]float64),
+	}
+	for q, w := range walks {
+		s.values[q] = w.Start
+	}
+	return s
+}
+
+// NewSimulatedDHT22 creates a simulated temperature and humidity sensor
+func NewSimulatedDHT22(name string) *Simulated {
+	return NewSimulated(name, map[Quantity]Walk{
+		Temperature: {Start: 20, Min: 5, Max: 35, Step: 0.3, Spikes: 0.05},
+		Humidity:    {Start: 55, Min: 20, Max: 95, Step: 1, Spikes: 0.05},
+	})
+}
+
+// NewSimulatedTSL2561 creates a simulated luminosity sensor
+func NewSimulatedTSL2561(name string) *Simulated {
+	return NewSimulated(name, map[Quantity]Walk{
+		Lux:       {Start: 60, Min: 0, Max: 400, Step: 20},
+		Broadband: {Start: 900, Min: 0, Max: 6000, Step: 200},
+		Infrared:  {Start: 300, Min: 0, Max: 2000, Step: 60},
+	})
+}
+
+// Name returns the sensor ID
+func (s *Simulated) Name() string {
+	return s.name
+}
+
+// Read returns the next simulated values
+func (s *Simulated) Read(ctx context.Context) (Readings, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make(map[Quantity]float64, len(s.walks))
+	for q, w := range s.walks {
+		v := s.values[q]
+		if len(w.Script) > 0 {
+			v = w.Script[s.step%len(w.Script)]
+		} else {
+			v += (s.rnd.Float64()*2 - 1) * w.Step
+			if v < w.Min {
+				v = w.Min
+			} else if v > w.Max {
+				v = w.Max
+			}
+		}
+		s.values[q] = v
+		if w.Spikes > 0 && s.rnd.Float64() < w.Spikes {
+			v += (w.Max - w.Min) * float64(1-2*s.rnd.Intn(2))
+		}
+		values[q] = v
+	}
+	s.step++
+	return newReadings(s.name, time.Now(), values), nil
+}
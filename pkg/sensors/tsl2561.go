@@ -0,0 +1,54 @@
+package sensors
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/flock"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// TSL2561 is a TSL2561 luminosity sensor on the I2C bus
+type TSL2561 struct {
+	name   string
+	driver *i2c.TSL2561Driver
+	lock   *flock.Flock
+}
+
+// NewTSL2561 creates a TSL2561 sensor on the given I2C bus and address. Access
+// to the sensor is serialised with other processes through the lock file.
+func NewTSL2561(name string, conn i2c.Connector, bus, address int, lockFile string) *TSL2561 {
+	return &TSL2561{
+		name:   name,
+		driver: i2c.NewTSL2561Driver(conn, i2c.WithBus(bus), i2c.WithAddress(address), i2c.WithTSL2561Gain1X),
+		lock:   flock.New(lockFile),
+	}
+}
+
+// Name returns the sensor ID
+func (t *TSL2561) Name() string {
+	return t.name
+}
+
+// Device returns the gobot device to be added to a robot
+func (t *TSL2561) Device() gobot.Device {
+	return t.driver
+}
+
+// Read returns lux together with raw broadband and IR channel counts
+func (t *TSL2561) Read(ctx context.Context) (Readings, error) {
+	var broadband, ir uint16
+	err := withLock(ctx, t.lock, func() (err error) {
+		broadband, ir, err = t.driver.GetLuminocity()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReadings(t.name, time.Now(), map[Quantity]float64{
+		Lux:       float64(t.driver.CalculateLux(broadband, ir)),
+		Broadband: float64(broadband),
+		Infrared:  float64(ir),
+	}), nil
+}
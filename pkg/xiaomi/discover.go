@@ -0,0 +1,72 @@
+package xiaomi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// LANPort is the UDP port the gateway answers LAN protocol commands on
+const LANPort = 9898
+
+// Discover asks the gateway at address for its sub-devices and reads the
+// model of each, waiting at most timeout for every reply
+func Discover(address string, timeout time.Duration) (Registry, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(address, strconv.Itoa(LANPort)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// the ID list is a JSON encoded array in data
+	reply, err := lanCommand(conn, `{"cmd":"get_id_list"}`, "get_id_list_ack", "", timeout)
+	if err != nil {
+		return nil, err
+	}
+	var m message
+	var ids []string
+	if err := json.Unmarshal(reply, &m); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(m.Data), &ids); err != nil {
+		return nil, fmt.Errorf("invalid device list %q:%v", m.Data, err)
+	}
+
+	var r Registry
+	for _, id := range ids {
+		reply, err := lanCommand(conn, fmt.Sprintf(`{"cmd":"read","sid":%q}`, id), "read_ack", id, timeout)
+		if err != nil {
+			return r, fmt.Errorf("read %s:%v", id, err)
+		}
+		e, err := parseEvent(reply)
+		if err != nil {
+			return r, fmt.Errorf("read %s:%v", id, err)
+		}
+		r.Observe(e)
+	}
+	return r, nil
+}
+
+// lanCommand sends cmd and waits for a reply with the given cmd and sid
+func lanCommand(conn net.Conn, cmd, ack, sid string, timeout time.Duration) ([]byte, error) {
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	b := make([]byte, 2048)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		var m message
+		if err := json.Unmarshal(b[:n], &m); err != nil {
+			continue
+		}
+		if m.Cmd == ack && (sid == "" || m.SID == sid) {
+			return b[:n], nil
+		}
+	}
+}
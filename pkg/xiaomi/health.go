@@ -0,0 +1,93 @@
+package xiaomi
+
+import (
+	"sync"
+	"time"
+)
+
+// Health is how a device has been responding
+type Health struct {
+	// when tracking started
+	Since time.Time
+	// consecutive failed reads and the last error
+	Failures  int
+	LastError string
+	// last successful read or event received
+	LastSuccess time.Time
+	// battery voltage in mV as last read or reported, 0 if unknown
+	Voltage   int
+	VoltageAt time.Time
+}
+
+// Unreachable returns true if nothing was heard from the device, no
+// successful read nor event, for at least d. A device which went quiet
+// without any read failing, e.g. when only listening to gateway reports, is
+// unreachable too.
+func (h Health) Unreachable(d time.Duration) bool {
+	last := h.LastSuccess
+	if last.IsZero() {
+		last = h.Since
+	}
+	return time.Since(last) >= d
+}
+
+// HealthMonitor keeps the health of devices by ID
+type HealthMonitor struct {
+	mu      sync.Mutex
+	devices map[string]*Health
+}
+
+// NewHealthMonitor creates an empty monitor
+func NewHealthMonitor() *HealthMonitor {
+	return &HealthMonitor{devices: make(map[string]*Health)}
+}
+
+func (m *HealthMonitor) device(id string) *Health {
+	h, ok := m.devices[id]
+	if !ok {
+		h = &Health{Since: time.Now()}
+		m.devices[id] = h
+	}
+	return h
+}
+
+// Success records a successful read
+func (m *HealthMonitor) Success(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.device(id)
+	h.Failures, h.LastError, h.LastSuccess = 0, "", time.Now()
+}
+
+// Failure records a failed read
+func (m *HealthMonitor) Failure(id string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.device(id)
+	h.Failures++
+	h.LastError = err.Error()
+}
+
+// Voltage records a battery reading in mV
+func (m *HealthMonitor) Voltage(id string, mV int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.device(id)
+	h.Voltage, h.VoltageAt = mV, time.Now()
+}
+
+// Observe records an event from a device as a success, along with the
+// voltage it carries
+func (m *HealthMonitor) Observe(e Event) {
+	m.Success(e.SID)
+	if mV, ok := e.Voltage(); ok {
+		m.Voltage(e.SID, mV)
+	}
+}
+
+// Get returns the health of a device
+func (m *HealthMonitor) Get(id string) Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.device(id)
+}
@@ -0,0 +1,43 @@
+package xiaomi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnreachable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		h    Health
+		want bool
+	}{
+		{"just started", Health{Since: now}, false},
+		{"never heard from", Health{Since: now.Add(-time.Hour)}, true},
+		{"heard from lately", Health{Since: now.Add(-time.Hour), LastSuccess: now.Add(-time.Minute)}, false},
+		{"failing lately", Health{Since: now.Add(-time.Hour), LastSuccess: now.Add(-time.Minute), Failures: 3}, false},
+		{"failing", Health{Since: now.Add(-time.Hour), LastSuccess: now.Add(-31 * time.Minute), Failures: 3}, true},
+		// only listening to reports, nothing failed
+		{"quiet", Health{Since: now.Add(-time.Hour), LastSuccess: now.Add(-31 * time.Minute)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.h.Unreachable(30 * time.Minute); got != tt.want {
+			t.Errorf("%s:Unreachable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	m := NewHealthMonitor()
+	m.Failure("158d0002676aec", errors.New("test"))
+	m.Failure("158d0002676aec", errors.New("test"))
+	if h := m.Get("158d0002676aec"); h.Failures != 2 || h.LastError != "test" || !h.LastSuccess.IsZero() {
+		t.Errorf("after failures %+v", h)
+	}
+	m.Observe(Event{SID: "158d0002676aec", Data: map[string]string{"voltage": "2995"}})
+	h := m.Get("158d0002676aec")
+	if h.Failures != 0 || h.LastError != "" || h.LastSuccess.IsZero() || h.Voltage != 2995 {
+		t.Errorf("after event %+v", h)
+	}
+}
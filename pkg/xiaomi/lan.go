@@ -0,0 +1,220 @@
+package xiaomi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/starryalley/smart_home/pkg/events"
+)
+
+// LANGroup is the multicast group the gateway sends reports and heartbeats to,
+// once the LAN protocol is enabled in the Mi Home app
+const LANGroup = "224.0.0.50:9898"
+
+// Event is a report or heartbeat sent by the gateway for itself or a
+// sub-device
+type Event struct {
+	Time time.Time
+	// "report" when something changed, "heartbeat" periodically
+	Cmd string
+	// Zigbee ID of the device, as used with Client
+	SID   string
+	Model string
+	// e.g. status:open for a door sensor, status:motion for a motion sensor
+	Data map[string]string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s %s:%v", e.Cmd, e.Model, e.SID, e.Data)
+}
+
+func (e Event) status(keys ...string) (string, bool) {
+	for _, k := range keys {
+		if v, ok := e.Data[k]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Contact returns true if a door/window sensor reports closed. ok is false if
+// the event carries no contact state.
+func (e Event) Contact() (closed, ok bool) {
+	v, ok := e.status("status", "window_status")
+	if !ok || (v != "open" && v != "close") {
+		return false, false
+	}
+	return v == "close", true
+}
+
+// Motion returns true if a motion sensor reports motion, false when it
+// reports no motion
+func (e Event) Motion() (motion, ok bool) {
+	if v, ok := e.status("status", "motion_status"); ok && v == "motion" {
+		return true, true
+	}
+	if _, ok := e.status("no_motion"); ok {
+		return false, true
+	}
+	return false, false
+}
+
+// Power returns true if a plug reports on
+func (e Event) Power() (on, ok bool) {
+	v, ok := e.status("status", "channel_0")
+	if !ok || (v != "on" && v != "off") {
+		return false, false
+	}
+	return v == "on", true
+}
+
+// Voltage returns the battery voltage in mV, sent with heartbeats
+func (e Event) Voltage() (mV int, ok bool) {
+	v, ok := e.Data["voltage"]
+	if !ok {
+		return 0, false
+	}
+	mV, err := strconv.Atoi(v)
+	return mV, err == nil
+}
+
+// message is the JSON sent by the gateway. Older firmware puts a JSON encoded
+// object in data, newer firmware a list of objects in params.
+type message struct {
+	Cmd    string                   `json:"cmd"`
+	Model  string                   `json:"model"`
+	SID    string                   `json:"sid"`
+	Data   string                   `json:"data"`
+	Params []map[string]interface{} `json:"params"`
+}
+
+func parseEvent(b []byte) (Event, error) {
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Event{}, err
+	}
+	e := Event{Time: time.Now(), Cmd: m.Cmd, SID: m.SID, Model: m.Model, Data: make(map[string]string)}
+	params := m.Params
+	if m.Data != "" {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(m.Data), &data); err != nil {
+			return Event{}, fmt.Errorf("invalid data %q:%v", m.Data, err)
+		}
+		params = append(params, data)
+	}
+	for _, p := range params {
+		for k, v := range p {
+			e.Data[k] = fmt.Sprint(v)
+		}
+	}
+	return e, nil
+}
+
+// Listener receives gateway events over multicast and publishes them, typed,
+// to the event bus
+type Listener struct {
+	conn   *net.UDPConn
+	events chan Event
+	// set once Events was called
+	listening int32
+}
+
+// ListenLAN joins LANGroup on the named network interface, or the system
+// default if empty
+func ListenLAN(ifname string) (*Listener, error) {
+	var iface *net.Interface
+	if ifname != "" {
+		var err error
+		if iface, err = net.InterfaceByName(ifname); err != nil {
+			return nil, err
+		}
+	}
+	addr, err := net.ResolveUDPAddr("udp4", LANGroup)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", iface, addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen gateway multicast:%v", err)
+	}
+	l := &Listener{conn: conn, events: make(chan Event, 16)}
+	go l.run()
+	return l, nil
+}
+
+// Events returns the received events. It's closed when the listener is.
+func (l *Listener) Events() <-chan Event {
+	atomic.StoreInt32(&l.listening, 1)
+	return l.events
+}
+
+// Close stops listening
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
+
+func (l *Listener) run() {
+	defer close(l.events)
+	b := make([]byte, 2048)
+	for {
+		n, _, err := l.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		e, err := parseEvent(b[:n])
+		if err != nil {
+			log.Printf("invalid gateway message %q:%v\n", b[:n], err)
+			continue
+		}
+		for _, t := range e.Typed() {
+			events.Publish(t)
+		}
+		if atomic.LoadInt32(&l.listening) == 0 {
+			continue
+		}
+		select {
+		case l.events <- e:
+		default:
+			log.Printf("gateway event dropped, nobody listening:%v\n", e)
+		}
+	}
+}
+
+func state(b bool, yes, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// Typed returns what the gateway event reports as typed events, e.g. a door
+// opened and the battery voltage of its sensor
+func (e Event) Typed() []events.Event {
+	var typed []events.Event
+	add := func(kind events.Kind, state string) {
+		t := events.New(e.SID, kind, "", state).With("model", e.Model).With("cmd", e.Cmd)
+		t.Time = e.Time
+		typed = append(typed, t)
+	}
+	if closed, ok := e.Contact(); ok {
+		add(events.Contact, state(closed, events.Closed, events.Open))
+	}
+	if motion, ok := e.Motion(); ok {
+		add(events.Motion, state(motion, events.MotionDetected, events.NoMotion))
+	}
+	if on, ok := e.Power(); ok {
+		add(events.Power, state(on, events.On, events.Off))
+	}
+	if v, ok := e.status("status"); ok && (v == "vibrate" || v == "tilt" || v == "free_fall") {
+		add(events.Tamper, v)
+	}
+	if mV, ok := e.Voltage(); ok {
+		add(events.Battery, strconv.Itoa(mV))
+	}
+	return typed
+}
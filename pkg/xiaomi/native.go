@@ -0,0 +1,79 @@
+package xiaomi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/starryalley/smart_home/pkg/miio"
+)
+
+// Native is a Client talking the miIO protocol to the gateway directly,
+// which relays property reads and writes to its Zigbee sub-devices
+type Native struct {
+	*miio.Client
+}
+
+// NewNative creates a Client for the gateway at address with the given hex token
+func NewNative(address, token string) (*Native, error) {
+	c, err := miio.NewClient(address, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Native{c}, nil
+}
+
+// Open returns a Native client if address is set, otherwise the miio CLI
+// found in binPath
+func Open(address, token, binPath string) (Client, error) {
+	if address == "" {
+		return NewCLI(binPath), nil
+	}
+	return NewNative(address, token)
+}
+
+// sub-devices are addressed by their Zigbee ID prefixed with the model family
+func sid(deviceID string) string {
+	return "lumi." + deviceID
+}
+
+// gateway values of boolean properties, normalised to what the CLI prints
+var boolValues = map[string]string{
+	"on":    "true",
+	"off":   "false",
+	"close": "true",
+	"open":  "false",
+}
+
+// Get returns the value of a device property
+func (n *Native) Get(deviceID, property string) (string, error) {
+	var result []interface{}
+	if err := n.Call("get_device_prop", []string{sid(deviceID), property}, &result); err != nil {
+		return "", err
+	}
+	if len(result) != 1 {
+		return "", fmt.Errorf("Unexpected get_device_prop result:%v", result)
+	}
+	switch v := result[0].(type) {
+	case string:
+		if b, ok := boolValues[v]; ok {
+			return b, nil
+		}
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("Unexpected %s value:%v", property, result[0])
+}
+
+// Set changes the value of a device property. Booleans are sent as "on"/"off".
+func (n *Native) Set(deviceID, property, value string) error {
+	if b, err := strconv.ParseBool(value); err == nil {
+		value = "off"
+		if b {
+			value = "on"
+		}
+	}
+	return n.Call("set_device_prop", map[string]string{"sid": sid(deviceID), property: value}, nil)
+}
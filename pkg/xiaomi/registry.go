@@ -0,0 +1,149 @@
+package xiaomi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Capability is something a device can report or do
+type Capability string
+
+// capabilities of gateway sub-devices
+const (
+	CapContact     Capability = "contact"
+	CapMotion      Capability = "motion"
+	CapPower       Capability = "power"
+	CapButton      Capability = "button"
+	CapTemperature Capability = "temperature"
+	CapHumidity    Capability = "humidity"
+	CapPressure    Capability = "pressure"
+)
+
+// capabilities of known models, as reported by the gateway
+var modelCapabilities = map[string][]Capability{
+	"magnet":            {CapContact},
+	"sensor_magnet.aq2": {CapContact},
+	"motion":            {CapMotion},
+	"sensor_motion.aq2": {CapMotion},
+	"plug":              {CapPower},
+	"ctrl_86plug":       {CapPower},
+	"ctrl_86plug.aq1":   {CapPower},
+	"switch":            {CapButton},
+	"sensor_switch.aq2": {CapButton},
+	"sensor_ht":         {CapTemperature, CapHumidity},
+	"weather.v1":        {CapTemperature, CapHumidity, CapPressure},
+}
+
+// Device is a gateway sub-device
+type Device struct {
+	// friendly name, e.g. "rear door"
+	Name string `yaml:"name"`
+	// Zigbee ID as used by the gateway, e.g. 158d0002676aec
+	ID    string `yaml:"id"`
+	Model string `yaml:"model,omitempty"`
+	// only needed for models not known here
+	Caps []Capability `yaml:"capabilities,omitempty"`
+}
+
+func (d Device) String() string {
+	if d.Name == "" || d.Name == d.ID {
+		return d.ID
+	}
+	return fmt.Sprintf("%s (%s)", d.Name, d.ID)
+}
+
+// Capabilities returns what the device can do, nil if unknown
+func (d Device) Capabilities() []Capability {
+	if len(d.Caps) > 0 {
+		return d.Caps
+	}
+	return modelCapabilities[d.Model]
+}
+
+// Check returns an error if the device is known not to have capability c
+func (d Device) Check(c Capability) error {
+	caps := d.Capabilities()
+	if caps == nil {
+		return nil
+	}
+	for _, have := range caps {
+		if have == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("device %v (%s) has no %s", d, d.Model, c)
+}
+
+// Registry is the list of known sub-devices, e.g.
+//
+//   - {name: floor lamp, id: 158d0002498b8e, model: plug}
+//   - {name: rear door, id: 158d0002676aec, model: magnet}
+type Registry []Device
+
+// a Zigbee ID, accepted for devices not in the registry
+var idPattern = regexp.MustCompile(`^[0-9a-f]{12,16}$`)
+
+// Lookup finds a device by name (ignoring case) or ID. IDs of devices not in
+// the registry are accepted too, with unknown capabilities.
+func (r Registry) Lookup(ref string) (Device, error) {
+	for _, d := range r {
+		if strings.EqualFold(d.Name, ref) || d.ID == ref {
+			return d, nil
+		}
+	}
+	if idPattern.MatchString(ref) {
+		return Device{Name: ref, ID: ref}, nil
+	}
+	return Device{}, fmt.Errorf("unknown device %q", ref)
+}
+
+// Observe adds the device sending e if it's not known yet, named after its
+// model. It returns true if it was added.
+func (r *Registry) Observe(e Event) bool {
+	if e.SID == "" || e.Model == "" || e.Model == "gateway" {
+		return false
+	}
+	for i, d := range *r {
+		if d.ID == e.SID {
+			if d.Model == "" {
+				(*r)[i].Model = e.Model
+			}
+			return false
+		}
+	}
+	*r = append(*r, Device{Name: defaultName(e.Model, e.SID), ID: e.SID, Model: e.Model})
+	return true
+}
+
+// e.g. magnet-676aec
+func defaultName(model, id string) string {
+	if len(id) > 6 {
+		id = id[len(id)-6:]
+	}
+	return model + "-" + id
+}
+
+// Validate checks names and IDs are set and unique
+func (r Registry) Validate() error {
+	var errs []string
+	names := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, d := range r {
+		name := strings.ToLower(d.Name)
+		switch {
+		case d.Name == "" || d.ID == "":
+			errs = append(errs, fmt.Sprintf("device %q:name and id are required", d.Name+d.ID))
+		case names[name]:
+			errs = append(errs, fmt.Sprintf("duplicate device name %q", d.Name))
+		case ids[d.ID]:
+			errs = append(errs, fmt.Sprintf("duplicate device id %s", d.ID))
+		}
+		names[name], ids[d.ID] = true, true
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid devices:" + strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package xiaomi
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Simulated is an in-memory Client. Boolean properties listed in Flip are
+// toggled randomly on read with the given probability, which is enough to
+// simulate a door contact being opened and closed.
+type Simulated struct {
+	Flip map[string]float64
+	// probability of a read failing, as if the device was out of reach
+	Fail float64
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	props map[string]string
+}
+
+// NewSimulated creates a simulated gateway. Every property reads "false"
+// until set, except contacts which start closed ("true") and battery
+// voltages which read a healthy 3015 mV.
+func NewSimulated() *Simulated {
+	return &Simulated{
+		Flip:  map[string]float64{"contact": 0.1},
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		props: make(map[string]string),
+	}
+}
+
+// Get returns the value of a device property
+func (s *Simulated) Get(deviceID, property string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Fail > 0 && s.rnd.Float64() < s.Fail {
+		return "", fmt.Errorf("[sim] %s unreachable", deviceID)
+	}
+	key := deviceID + "/" + property
+	v, ok := s.props[key]
+	if !ok {
+		v = strconv.FormatBool(property == "contact")
+		if property == "voltage" {
+			v = "3015"
+		}
+	}
+	if p := s.Flip[property]; p > 0 && s.rnd.Float64() < p {
+		b, _ := strconv.ParseBool(v)
+		v = strconv.FormatBool(!b)
+		log.Printf("[sim] %s %s:%s\n", deviceID, property, v)
+	}
+	s.props[key] = v
+	return v, nil
+}
+
+// Set changes the value of a device property
+func (s *Simulated) Set(deviceID, property, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Printf("[sim] %s %s:%s\n", deviceID, property, value)
+	s.props[deviceID+"/"+property] = value
+	return nil
+}
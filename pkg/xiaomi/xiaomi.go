@@ -0,0 +1,76 @@
+package xiaomi
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/starryalley/smart_home/pkg/cmds"
+)
+
+// Client queries and controls Xiaomi gateway sub-devices
+type Client interface {
+	// Get returns the value of a device property, e.g. "contact" or "power"
+	Get(deviceID, property string) (string, error)
+	// Set changes the value of a device property
+	Set(deviceID, property, value string) error
+}
+
+// CLI is a Client which runs the Node.js miio command line tool
+type CLI struct {
+	node string
+	miio string
+}
+
+// NewCLI creates a Client using node and miio found in binPath
+func NewCLI(binPath string) *CLI {
+	return &CLI{
+		node: path.Join(binPath, "node"),
+		miio: path.Join(binPath, "miio"),
+	}
+}
+
+// Get returns the value of a device property
+func (c *CLI) Get(deviceID, property string) (string, error) {
+	outs, err := cmds.RunCmdWithResult(fmt.Sprintf("%s %s control %s %s", c.node, c.miio, deviceID, property))
+	if err != nil {
+		return "", err
+	}
+	if len(outs) != 3 {
+		return "", fmt.Errorf("Unexpected miio command output:%v", outs)
+	}
+	return outs[1], nil
+}
+
+// Set changes the value of a device property
+func (c *CLI) Set(deviceID, property, value string) error {
+	return cmds.RunCmd(fmt.Sprintf("%s %s control %s %s %s", c.node, c.miio, deviceID, property, value))
+}
+
+// GetBool returns a boolean device property such as "contact" or "power"
+func GetBool(c Client, deviceID, property string) (bool, error) {
+	v, err := c.Get(deviceID, property)
+	if err != nil {
+		return false, err
+	}
+	switch v {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("Unexpected sensor output:%v", v)
+}
+
+// GetVoltage returns the battery voltage of a sub-device in mV
+func GetVoltage(c Client, deviceID string) (int, error) {
+	v, err := c.Get(deviceID, "voltage")
+	if err != nil {
+		return 0, err
+	}
+	mV, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected voltage:%v", v)
+	}
+	return mV, nil
+}